@@ -0,0 +1,52 @@
+package fsm
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// bindPrefixes 是 BindCallbacks 识别的方法名前缀
+var bindPrefixes = []string{"Before", "Leave", "Enter", "After"}
+
+/**
+BindCallbacks: 把 target 中签名为 func(*Event) 的导出方法按名字转换为回调
+BeforeScan, EnterRunning, LeaveIdle, AfterFinish 分别对应 before_scan, enter_running, leave_idle, after_finish,
+前缀之后的部分由驼峰转换为下划线分隔的小写形式; 不带这些前缀或签名不符的方法会被忽略
+*/
+func BindCallbacks(target interface{}) Callbacks {
+	callbacks := make(Callbacks)
+	v := reflect.ValueOf(target)
+	t := v.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		fn, ok := v.Method(i).Interface().(func(*Event))
+		if !ok {
+			continue
+		}
+		name := t.Method(i).Name
+		for _, prefix := range bindPrefixes {
+			if rest := strings.TrimPrefix(name, prefix); rest != name && rest != "" {
+				callbacks[strings.ToLower(prefix)+"_"+snakeCase(rest)] = Callback(fn)
+				break
+			}
+		}
+	}
+	return callbacks
+}
+
+// snakeCase 把驼峰形式的名字转换为下划线分隔的小写形式, 连续的大写字母视为一个单词
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
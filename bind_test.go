@@ -0,0 +1,49 @@
+package fsm
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// scanHandler 的方法按命名约定绑定为回调
+type scanHandler struct {
+	log []string
+}
+
+func (h *scanHandler) BeforeScan(e *Event)      { h.log = append(h.log, "before_scan") }
+func (h *scanHandler) LeaveIdle(e *Event)       { h.log = append(h.log, "leave_idle") }
+func (h *scanHandler) EnterScanning(e *Event)   { h.log = append(h.log, "enter_scanning") }
+func (h *scanHandler) AfterScan(e *Event)       { h.log = append(h.log, "after_scan") }
+func (h *scanHandler) EnterHTTPServer(e *Event) {}
+func (h *scanHandler) Enter(e *Event)           {}
+func (h *scanHandler) AfterCount() int          { return len(h.log) }
+func (h *scanHandler) Reset(e *Event)           {}
+
+func TestBindCallbacksKeys(t *testing.T) {
+	callbacks := BindCallbacks(&scanHandler{})
+	var keys []string
+	for key := range callbacks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	want := []string{"after_scan", "before_scan", "enter_http_server", "enter_scanning", "leave_idle"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("BindCallbacks() keys = %v, want %v", keys, want)
+	}
+}
+
+func TestBindCallbacksFirePhases(t *testing.T) {
+	h := &scanHandler{}
+	callbacks := BindCallbacks(h)
+	delete(callbacks, "enter_http_server")
+	m := NewMachine("idle", exampleEvents(), callbacks)
+
+	if err := m.Event("scan"); err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+	want := []string{"before_scan", "leave_idle", "enter_scanning", "after_scan"}
+	if !reflect.DeepEqual(h.log, want) {
+		t.Fatalf("callbacks = %v, want %v", h.log, want)
+	}
+}
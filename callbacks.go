@@ -0,0 +1,112 @@
+package fsm
+
+import "sort"
+
+// CallbackInfo 描述一个已注册的回调, Target 为空表示全局回调
+type CallbackInfo struct {
+	Phase  string
+	Target string
+}
+
+// 回调的阶段, 用于 OverrideCallback
+const (
+	CallbackBeforeEvent = callbackBeforeEvent
+	CallbackLeaveState  = callbackLeaveState
+	CallbackEnterState  = callbackEnterState
+	CallbackAfterEvent  = callbackAfterEvent
+)
+
+// callbackPhases 是各类回调对应的阶段名
+var callbackPhases = map[int]string{
+	callbackBeforeEvent:   "before_event",
+	callbackLeaveState:    "leave_state",
+	callbackEnterState:    "enter_state",
+	callbackAfterEvent:    "after_event",
+	callbackLeaveCanceled: "on_leave_canceled",
+	callbackAsyncTimeout:  "on_async_timeout",
+	callbackDenied:        "on_denied",
+	callbackEnterTag:      "enter_tag",
+	callbackEnterOnce:     "once_enter",
+}
+
+/**
+RegisteredCallbacks: 返回所有已注册的回调, 按 (Phase, Target) 排序
+*/
+func (m *Machine) RegisteredCallbacks() []CallbackInfo {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+
+	infos := make([]CallbackInfo, 0, len(m.callbacks))
+	for key := range m.callbacks {
+		infos = append(infos, CallbackInfo{Phase: callbackPhases[key.callbackType], Target: key.target})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Phase != infos[j].Phase {
+			return infos[i].Phase < infos[j].Phase
+		}
+		return infos[i].Target < infos[j].Target
+	})
+	return infos
+}
+
+/**
+OverrideCallback: 临时替换 phase 阶段针对 target 的回调(target 为空表示全局回调), 主要用于测试
+返回的 restore 函数恢复原来的回调; 替换和恢复都会等待正在执行的事件完成
+*/
+func (m *Machine) OverrideCallback(phase int, target string, cb Callback) (restore func()) {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+
+	key := cKey{target: target, callbackType: phase}
+	prev, existed := m.callbacks[key]
+	m.callbacks[key] = cb
+	return func() {
+		m.eventMu.Lock()
+		defer m.eventMu.Unlock()
+		if existed {
+			m.callbacks[key] = prev
+		} else {
+			delete(m.callbacks, key)
+		}
+	}
+}
+
+/**
+CallbackWiring: 以 "阶段:目标" 的形式返回所有已注册的回调(已排序), 全局回调的目标为 "*"
+例如 before_event:scan, enter_state:running, after_event:*, 便于比较两个 Machine 的回调
+*/
+func (m *Machine) CallbackWiring() []string {
+	infos := m.RegisteredCallbacks()
+	wiring := make([]string, 0, len(infos))
+	for _, info := range infos {
+		target := info.Target
+		if target == "" {
+			target = "*"
+		}
+		wiring = append(wiring, info.Phase+":"+target)
+	}
+	sort.Strings(wiring)
+	return wiring
+}
+
+/**
+DiffCallbackWiring: 比较 a 和 b 的 CallbackWiring, added 为只在 b 中的回调, removed 为只在 a 中的回调
+*/
+func DiffCallbackWiring(a, b *Machine) (added, removed []string) {
+	before := make(map[string]bool)
+	for _, w := range a.CallbackWiring() {
+		before[w] = true
+	}
+	for _, w := range b.CallbackWiring() {
+		if before[w] {
+			delete(before, w)
+		} else {
+			added = append(added, w)
+		}
+	}
+	for w := range before {
+		removed = append(removed, w)
+	}
+	sort.Strings(removed)
+	return added, removed
+}
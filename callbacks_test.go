@@ -0,0 +1,327 @@
+package fsm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSpecificCallbacksRunBeforeGlobal(t *testing.T) {
+	var order []string
+	record := func(name string) Callback {
+		return func(e *Event) { order = append(order, name) }
+	}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_event":   record("before_event"),
+		"before_scan":    record("before_scan"),
+		"leave_state":    record("leave_state"),
+		"leave_idle":     record("leave_idle"),
+		"enter_state":    record("enter_state"),
+		"enter_scanning": record("enter_scanning"),
+		"after_event":    record("after_event"),
+		"after_scan":     record("after_scan"),
+	})
+
+	if err := m.Event("scan"); err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+	want := []string{
+		"before_scan", "before_event",
+		"leave_idle", "leave_state",
+		"enter_scanning", "enter_state",
+		"after_scan", "after_event",
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("callback order = %v, want %v", order, want)
+	}
+}
+
+func TestAmbiguousCallbackNameResolvesToState(t *testing.T) {
+	var got []string
+	m := NewMachine("idle", Events{
+		{Name: "scan", Src: []string{"idle"}, Dst: "scan"},
+	}, Callbacks{
+		"scan":       func(e *Event) { got = append(got, "enter") },
+		"after_scan": func(e *Event) { got = append(got, "after") },
+	})
+
+	if want := []string{"scan"}; !reflect.DeepEqual(m.AmbiguousCallbacks(), want) {
+		t.Fatalf("AmbiguousCallbacks() = %v, want %v", m.AmbiguousCallbacks(), want)
+	}
+	if err := m.Event("scan"); err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+	// 无前缀的 "scan" 解析为状态的 enter 回调, 事件的 after 回调需要显式前缀
+	if want := []string{"enter", "after"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("callbacks ran %v, want %v", got, want)
+	}
+}
+
+func TestNewMachineCheckedRejectsUnknownCallback(t *testing.T) {
+	noop := func(e *Event) {}
+	_, err := NewMachineChecked("idle", exampleEvents(), Callbacks{
+		"enter_scaning": noop,
+		"enter_state":   noop,
+	})
+	if unknown, ok := err.(UnknownCallbackTargetError); !ok || unknown.Name != "enter_scaning" {
+		t.Fatalf("NewMachineChecked = %v, want UnknownCallbackTargetError for enter_scaning", err)
+	}
+
+	m, err := NewMachineChecked("idle", exampleEvents(), Callbacks{
+		"enter_scanning": noop,
+		"after_event":    noop,
+		"finish":         noop,
+	})
+	if err != nil || m == nil {
+		t.Fatalf("NewMachineChecked with valid names = %v, %v", m, err)
+	}
+}
+
+func TestOnTransitionHooks(t *testing.T) {
+	var order []string
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_state": func(e *Event) { order = append(order, "enter "+e.Dst) },
+		"after_event": func(e *Event) { order = append(order, "after "+e.Event) },
+	})
+	m.OnTransition(func(from, to, event string, args []interface{}) {
+		order = append(order, "first "+event+" "+from+"->"+to)
+		if len(args) != 1 || args[0] != event+"-arg" {
+			t.Errorf("hook got args %v for %s", args, event)
+		}
+	})
+	m.OnTransition(func(from, to, event string, args []interface{}) {
+		order = append(order, "second "+event)
+	})
+
+	m.Event("scan", "scan-arg")
+	m.Event("working", "working-arg")
+	m.Event("finish", "finish-arg")
+
+	// 自迁移 working 没有完成状态迁移, 不会调用钩子
+	want := []string{
+		"enter scanning", "first scan idle->scanning", "second scan", "after scan",
+		"after working",
+		"enter idle", "first finish scanning->idle", "second finish", "after finish",
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+}
+
+func TestOnLeaveCanceled(t *testing.T) {
+	errBusy := errors.New("busy")
+	var got *Event
+	m := NewMachine("scanning", exampleEvents(), Callbacks{
+		"leave_scanning":    func(e *Event) { e.Cancel(errBusy) },
+		"on_leave_canceled": func(e *Event) { got = e },
+	})
+
+	if _, ok := m.Event("finish").(CanceledError); !ok {
+		t.Fatalf("Event(finish) should be canceled")
+	}
+	if got == nil || got.Src != "scanning" || got.Event != "finish" || got.Err != errBusy {
+		t.Fatalf("on_leave_canceled got %+v, want finish from scanning with errBusy", got)
+	}
+
+	// before 回调取消时不触发
+	got = nil
+	m = NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan":       func(e *Event) { e.Cancel() },
+		"on_leave_canceled": func(e *Event) { got = e },
+	})
+	m.Event("scan")
+	if got != nil {
+		t.Fatalf("on_leave_canceled fired for a before_ cancellation")
+	}
+}
+
+func TestRegisteredCallbacks(t *testing.T) {
+	noop := func(e *Event) {}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan":       noop,
+		"leave_idle":        noop,
+		"enter_state":       noop,
+		"scanning":          noop,
+		"finish":            noop,
+		"on_leave_canceled": noop,
+	})
+
+	want := []CallbackInfo{
+		{Phase: "after_event", Target: "finish"},
+		{Phase: "before_event", Target: "scan"},
+		{Phase: "enter_state", Target: ""},
+		{Phase: "enter_state", Target: "scanning"},
+		{Phase: "leave_state", Target: "idle"},
+		{Phase: "on_leave_canceled", Target: ""},
+	}
+	if got := m.RegisteredCallbacks(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("RegisteredCallbacks() = %v, want %v", got, want)
+	}
+}
+
+func TestOverrideCallback(t *testing.T) {
+	var calls []string
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_scanning": func(e *Event) { calls = append(calls, "real") },
+	})
+
+	restore := m.OverrideCallback(CallbackEnterState, "scanning", func(e *Event) { calls = append(calls, "mock") })
+	m.Event("scan")
+	m.Event("finish")
+	restore()
+	m.Event("scan")
+
+	// 没有原回调时恢复会删除替换的回调
+	m.Event("finish")
+	restoreIdle := m.OverrideCallback(CallbackEnterState, "idle", func(e *Event) { calls = append(calls, "idle mock") })
+	restoreIdle()
+	m.Event("scan")
+	m.Event("finish")
+
+	if want := []string{"mock", "real", "real"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestEnterTagCallbacks(t *testing.T) {
+	var order []string
+	record := func(name string) Callback {
+		return func(e *Event) { order = append(order, name+" "+e.Dst) }
+	}
+	m := NewMachine("idle", Events{
+		{Name: "start", Src: []string{"idle"}, Dst: "running"},
+		{Name: "pause", Src: []string{"running"}, Dst: "paused"},
+		{Name: "stop", Src: []string{"paused"}, Dst: "idle"},
+	}, Callbacks{
+		"enter_running":    record("specific"),
+		"enter_tag_active": record("tag"),
+		"enter_state":      record("global"),
+	}, WithStateMeta("running", "active"), WithStateMeta("paused", "active"))
+
+	m.Event("start")
+	m.Event("pause")
+	m.Event("stop")
+
+	want := []string{
+		"specific running", "tag running", "global running",
+		"tag paused", "global paused",
+		"global idle",
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+}
+
+func TestOnceEnterCallback(t *testing.T) {
+	var log []string
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"once_enter_scanning": func(e *Event) { log = append(log, "once") },
+		"enter_scanning":      func(e *Event) { log = append(log, "enter") },
+	})
+
+	m.Event("scan")
+	m.Event("finish")
+	m.Event("scan")
+	if want := []string{"once", "enter", "enter"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("callbacks = %v, want %v", log, want)
+	}
+
+	// Reset 清除执行记录, 之后再次进入时重新执行
+	log = nil
+	m.Reset()
+	m.Event("scan")
+	if want := []string{"once", "enter"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("callbacks after Reset = %v, want %v", log, want)
+	}
+}
+
+func TestOnEnterStateExcept(t *testing.T) {
+	var log []string
+	m := NewMachine("a", Events{
+		{Name: "next", Src: []string{"a"}, Dst: "b"},
+		{Name: "next", Src: []string{"b"}, Dst: "c"},
+		{Name: "next", Src: []string{"c"}, Dst: "d"},
+		{Name: "next", Src: []string{"d"}, Dst: "a"},
+	}, Callbacks{
+		"enter_state": func(e *Event) { log = append(log, "global "+e.Dst) },
+	})
+	// 每个回调有各自的排除列表, 已有的 enter_state 回调不受影响
+	m.OnEnterStateExcept([]string{"b", "d"}, func(e *Event) { log = append(log, "skip-bd "+e.Dst) })
+	m.OnEnterStateExcept([]string{"c"}, func(e *Event) { log = append(log, "skip-c "+e.Dst) })
+
+	for i := 0; i < 4; i++ {
+		if err := m.Event("next"); err != nil {
+			t.Fatalf("Event(next) = %v", err)
+		}
+	}
+	want := []string{
+		"global b", "skip-c b",
+		"global c", "skip-bd c",
+		"global d", "skip-c d",
+		"global a", "skip-bd a", "skip-c a",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Fatalf("callbacks = %v, want %v", log, want)
+	}
+}
+
+func TestOnEnterStateExceptKeepsHandlerEnterState(t *testing.T) {
+	var excepted []string
+	h := &recordingHandler{}
+	m := NewMachine("idle", exampleEvents(), nil)
+	m.OnEnterStateExcept([]string{"scanning"}, func(e *Event) { excepted = append(excepted, e.Dst) })
+	m.RegisterHandler(h)
+
+	m.Event("scan")
+	m.Event("finish")
+	if want := []string{"idle"}; !reflect.DeepEqual(excepted, want) {
+		t.Fatalf("except callback fired for %v, want %v", excepted, want)
+	}
+	// Handler 的 EnterState 不受排除列表影响
+	want := []string{
+		"before scan", "leave idle", "enter scanning", "after scan",
+		"before finish", "leave scanning", "enter idle", "after finish",
+	}
+	if !reflect.DeepEqual(h.phases, want) {
+		t.Fatalf("handler phases = %v, want %v", h.phases, want)
+	}
+}
+
+func TestCallbackWiring(t *testing.T) {
+	noop := func(e *Event) {}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan":    noop,
+		"enter_scanning": noop,
+		"after_event":    noop,
+		"finish":         noop,
+	})
+	want := []string{"after_event:*", "after_event:finish", "before_event:scan", "enter_state:scanning"}
+	if got := m.CallbackWiring(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("CallbackWiring() = %v, want %v", got, want)
+	}
+}
+
+func TestDiffCallbackWiring(t *testing.T) {
+	noop := func(e *Event) {}
+	a := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan": noop,
+		"leave_idle":  noop,
+		"after_event": noop,
+	})
+	b := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan":    noop,
+		"enter_scanning": noop,
+		"enter_state":    noop,
+	})
+
+	added, removed := DiffCallbackWiring(a, b)
+	if want := []string{"enter_state:*", "enter_state:scanning"}; !reflect.DeepEqual(added, want) {
+		t.Fatalf("added = %v, want %v", added, want)
+	}
+	if want := []string{"after_event:*", "leave_state:idle"}; !reflect.DeepEqual(removed, want) {
+		t.Fatalf("removed = %v, want %v", removed, want)
+	}
+	if added, removed := DiffCallbackWiring(a, a); added != nil || removed != nil {
+		t.Fatalf("DiffCallbackWiring(a, a) = %v, %v; want nil, nil", added, removed)
+	}
+}
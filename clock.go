@@ -0,0 +1,25 @@
+package fsm
+
+import "time"
+
+// Clock 是 Machine 获取当前时间和设置定时器的来源, 可以在测试中替换为假时钟
+type Clock interface {
+	Now() time.Time
+	// AfterFunc 在 d 之后调用 f, 与 time.AfterFunc 语义相同
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer 是 Clock.AfterFunc 返回的定时器
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
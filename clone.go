@@ -0,0 +1,112 @@
+package fsm
+
+/**
+Clone: 复制 Machine 的定义, 回调, 守卫和选项, 新的 Machine 处于初始状态且尚未 Start
+运行时的数据(统计信息, 定时事件, 队列, 进行中的异步迁移)和子状态机不会被复制
+*/
+func (m *Machine) Clone() *Machine {
+	return m.CloneWith(nil)
+}
+
+/**
+CloneWith: 与 Clone 相同, 之后再按 NewMachine 的规则注册 overrides 中的回调, 同名回调以 overrides 为准
+无法解析的回调名会被忽略
+*/
+func (m *Machine) CloneWith(overrides Callbacks) *Machine {
+	m.stateMu.RLock()
+	c := &Machine{
+		name:                  m.name,
+		initial:               m.initial,
+		current:               m.initial,
+		initEvent:             m.initEvent,
+		transitions:           make(map[eKey]string, len(m.transitions)),
+		transitionMeta:        make(map[eKey]map[string]interface{}, len(m.transitionMeta)),
+		stateTags:             m.stateTags,
+		finalStates:           m.finalStates,
+		errorStates:           m.errorStates,
+		transient:             m.transient,
+		argCounts:             m.argCounts,
+		argsTransformer:       m.argsTransformer,
+		guards:                make(map[string][]GuardFunc, len(m.guards)),
+		guardFuncs:            make(map[string]GuardFunc, len(m.guardFuncs)),
+		namedGuards:           m.namedGuards,
+		disabled:              make(map[string]bool, len(m.disabled)),
+		rolePolicy:            make(map[string]map[string]bool, len(m.rolePolicy)),
+		macros:                make(map[string][]string, len(m.macros)),
+		callbacks:             make(map[cKey]Callback, len(m.callbacks)),
+		enterExcept:           append(m.enterExcept[:0:0], m.enterExcept...),
+		onTransition:          append(m.onTransition[:0:0], m.onTransition...),
+		onError:               append(m.onError[:0:0], m.onError...),
+		onFinal:               append(m.onFinal[:0:0], m.onFinal...),
+		ambiguousCallbacks:    append([]string(nil), m.ambiguousCallbacks...),
+		transitionerObj:       &transitionerStruct{},
+		asyncTimeout:          m.asyncTimeout,
+		noReentrancyCheck:     m.noReentrancyCheck,
+		strictReentrancy:      m.strictReentrancy,
+		raceCheck:             m.raceCheck,
+		noTransitionGuard:     m.noTransitionGuard,
+		noTransitionAsSuccess: m.noTransitionAsSuccess,
+		clock:                 m.clock,
+		metrics:               m.metrics,
+		lockMetrics:           m.lockMetrics,
+		jsonLog:               m.jsonLog,
+	}
+	for key, dst := range m.transitions {
+		c.transitions[key] = dst
+	}
+	for key, meta := range m.transitionMeta {
+		c.transitionMeta[key] = meta
+	}
+	for event, guards := range m.guards {
+		c.guards[event] = append([]GuardFunc(nil), guards...)
+	}
+	for name, guard := range m.guardFuncs {
+		c.guardFuncs[name] = guard
+	}
+	for event, disabled := range m.disabled {
+		c.disabled[event] = disabled
+	}
+	for role, events := range m.rolePolicy {
+		c.rolePolicy[role] = events
+	}
+	for name, steps := range m.macros {
+		c.macros[name] = steps
+	}
+	for key, fn := range m.callbacks {
+		c.callbacks[key] = fn
+	}
+	if m.inFlight != nil {
+		c.inFlight = make(map[string]bool)
+	}
+	if m.rateLimit != nil {
+		c.rateLimit = &rateLimiter{capacity: m.rateLimit.capacity, per: m.rateLimit.per}
+	}
+	c.middleware = append([]Middleware(nil), m.middleware...)
+	m.stateMu.RUnlock()
+
+	c.stateMu.writerPriority = m.stateMu.writerPriority
+	c.enteredAt = c.clock.Now()
+	if len(overrides) > 0 {
+		allEvents := make(map[string]bool)
+		allStatus := make(map[string]bool)
+		for key, dst := range c.transitions {
+			allEvents[key.event] = true
+			allStatus[key.src] = true
+			allStatus[dst] = true
+		}
+		c.registerCallbacks(overrides, allEvents, allStatus)
+		c.ambiguousCallbacks = dedupeSorted(c.ambiguousCallbacks)
+	}
+	return c
+}
+
+// dedupeSorted 去掉已排序的 names 中重复的元素
+func dedupeSorted(names []string) []string {
+	var out []string
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCloneWithOverridesCallbacks(t *testing.T) {
+	var log []string
+	record := func(name string) Callback {
+		return func(e *Event) { log = append(log, name) }
+	}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_scanning": record("shared enter"),
+		"after_scan":     record("shared after"),
+	})
+	m.Event("scan")
+
+	c := m.CloneWith(Callbacks{"enter_scanning": record("tenant enter")})
+	if c.Current() != "idle" {
+		t.Fatalf("clone Current() = %q, want initial state idle", c.Current())
+	}
+
+	log = nil
+	if err := c.Event("scan"); err != nil {
+		t.Fatalf("clone Event(scan) = %v", err)
+	}
+	if want := []string{"tenant enter", "shared after"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("clone callbacks = %v, want %v", log, want)
+	}
+
+	// 原 Machine 的回调不受影响
+	log = nil
+	m.Event("finish")
+	m.Event("scan")
+	if want := []string{"shared enter", "shared after"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("original callbacks = %v, want %v", log, want)
+	}
+}
+
+func TestCloneIndependentState(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	c := m.Clone()
+	c.Event("scan")
+	c.AddTransition("reset", "scanning", "idle")
+	if m.Current() != "idle" {
+		t.Fatalf("original Current() = %q, want idle", m.Current())
+	}
+	if m.Can("reset") || len(m.AvailableFrom("scanning")) != 3 {
+		t.Fatal("AddTransition on the clone should not change the original definition")
+	}
+}
@@ -1,12 +1,24 @@
 package fsm
 
+import (
+	"strconv"
+	"strings"
+)
+
+// InvalidEventError is returned by FSM.Event() when the event cannot be called
+// in the current state. Available lists the events that can be called instead.
 type InvalidEventError struct {
-	Event string
-	State string
+	Event     string
+	State     string
+	Available []string
 }
 
 func (e InvalidEventError) Error() string {
-	return "event " + e.Event + " inappropriate in current state " + e.State
+	msg := "event " + e.Event + " inappropriate in current state " + e.State
+	if len(e.Available) > 0 {
+		msg += ", available events: " + strings.Join(e.Available, ", ")
+	}
+	return msg
 }
 
 // UnknownEventError is returned by FSM.Event() when the event is not defined.
@@ -18,6 +30,101 @@ func (e UnknownEventError) Error() string {
 	return "event " + e.Event + " does not exist"
 }
 
+// UnknownStateError is returned when a state is not defined in the machine.
+type UnknownStateError struct {
+	State string
+}
+
+func (e UnknownStateError) Error() string {
+	return "state " + e.State + " does not exist"
+}
+
+// DanglingStateError is reported by FSM.Validate() for a state that has no
+// outgoing transitions and is not marked as final.
+type DanglingStateError struct {
+	State string
+}
+
+func (e DanglingStateError) Error() string {
+	return "state " + e.State + " has no outgoing transitions and is not final"
+}
+
+// UnreachableStateError is reported by FSM.Validate() for a state that cannot
+// be reached from the initial state.
+type UnreachableStateError struct {
+	State string
+}
+
+func (e UnreachableStateError) Error() string {
+	return "state " + e.State + " is not reachable from the initial state"
+}
+
+// UnsupportedVersionError is returned by FSM.UnmarshalBinary() when the data
+// is truncated or was encoded with an unknown format version.
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e UnsupportedVersionError) Error() string {
+	return "unsupported encoding version " + strconv.Itoa(e.Version)
+}
+
+// DefinitionMismatchError is returned when persisted state was produced by a
+// machine with a different definition fingerprint.
+type DefinitionMismatchError struct {
+	Want uint64
+	Got  uint64
+}
+
+func (e DefinitionMismatchError) Error() string {
+	return "definition fingerprint mismatch: want " + strconv.FormatUint(e.Want, 16) +
+		", got " + strconv.FormatUint(e.Got, 16)
+}
+
+// AmbiguousAdvanceError is returned by FSM.Advance() when there is not exactly
+// one event available in the current state.
+type AmbiguousAdvanceError struct {
+	Available []string
+}
+
+func (e AmbiguousAdvanceError) Error() string {
+	if len(e.Available) == 0 {
+		return "cannot advance: no events available"
+	}
+	return "cannot advance: multiple events available: " + strings.Join(e.Available, ", ")
+}
+
+// CycleError is returned by FSM.TopoSort() when the transition graph contains
+// a cycle. States lists the states of one such cycle.
+type CycleError struct {
+	States []string
+}
+
+func (e CycleError) Error() string {
+	return "transition graph has a cycle through states " + strings.Join(e.States, ", ")
+}
+
+// IdentifierCollisionError is returned by GenerateConstants() when different
+// names map to the same Go identifier.
+type IdentifierCollisionError struct {
+	Identifier string
+	Names      []string
+}
+
+func (e IdentifierCollisionError) Error() string {
+	return "names " + strings.Join(e.Names, ", ") + " all map to identifier " + e.Identifier
+}
+
+// NoMatchingEventError is returned by FSM.FireMatching() when no available
+// event satisfies the predicate.
+type NoMatchingEventError struct {
+	State string
+}
+
+func (e NoMatchingEventError) Error() string {
+	return "no available event in state " + e.State + " matches the predicate"
+}
+
 // InTransitionError is returned by FSM.Event() when an asynchronous transition
 // is already in progress.
 type InTransitionError struct {
@@ -36,6 +143,64 @@ func (e NotInTransitionError) Error() string {
 	return "transition inappropriate because no state change in progress"
 }
 
+// DisabledEventError is returned by FSM.Event() when the event has been
+// disabled with FSM.DisableEvent().
+type DisabledEventError struct {
+	Event string
+}
+
+func (e DisabledEventError) Error() string {
+	return "event " + e.Event + " is disabled"
+}
+
+// UnauthorizedEventError is returned by FSM.EventAs() when the role is not
+// allowed to fire the event by the policy set with FSM.SetRolePolicy().
+type UnauthorizedEventError struct {
+	Role  string
+	Event string
+}
+
+func (e UnauthorizedEventError) Error() string {
+	return "role " + e.Role + " is not allowed to fire event " + e.Event
+}
+
+// RateLimitedError is returned by FSM.Event() when the machine has reached the
+// limit configured with WithRateLimit().
+type RateLimitedError struct {
+	Event string
+}
+
+func (e RateLimitedError) Error() string {
+	return "event " + e.Event + " rejected by rate limit"
+}
+
+// ArgMismatchError is returned by FSM.Event() when the number of arguments does
+// not match EventDesc.ArgCount.
+type ArgMismatchError struct {
+	Event string
+	Want  int
+	Got   int
+}
+
+func (e ArgMismatchError) Error() string {
+	return "event " + e.Event + " expects " + strconv.Itoa(e.Want) + " arguments, got " + strconv.Itoa(e.Got)
+}
+
+// TransitionDeniedError is returned by FSM.Event() when a guard rejected the
+// transition. Guard names the guard that denied it, when known.
+type TransitionDeniedError struct {
+	Event string
+	State string
+	Guard string
+}
+
+func (e TransitionDeniedError) Error() string {
+	if e.Guard != "" {
+		return "event " + e.Event + " denied by guard " + e.Guard + " in state " + e.State
+	}
+	return "event " + e.Event + " denied by guard in state " + e.State
+}
+
 // NoTransitionError is returned by FSM.Event() when no transition have happened,
 // for example if the source and destination states are the same.
 type NoTransitionError struct {
@@ -49,17 +214,44 @@ func (e NoTransitionError) Error() string {
 	return "no transition"
 }
 
+// InvalidRedirectError is returned by Event.Redirect() when the destination is
+// not declared for the event or the redirect happens outside before_event.
+type InvalidRedirectError struct {
+	Event string
+	Dst   string
+}
+
+func (e InvalidRedirectError) Error() string {
+	return "event " + e.Event + " cannot be redirected to state " + e.Dst
+}
+
+// SelfTransitionError is returned by FSM.EventStrict() when the event would not
+// change the current state.
+type SelfTransitionError struct {
+	Event string
+	State string
+}
+
+func (e SelfTransitionError) Error() string {
+	return "event " + e.Event + " would not leave state " + e.State
+}
+
 // CanceledError is returned by FSM.Event() when a callback have canceled a
-// transition.
+// transition. Code is set when the callback used Event.CancelWithReason.
 type CanceledError struct {
-	Err error
+	Err  error
+	Code string
 }
 
 func (e CanceledError) Error() string {
+	msg := "transition canceled"
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
 	if e.Err != nil {
-		return "transition canceled with error: " + e.Err.Error()
+		return msg + " with error: " + e.Err.Error()
 	}
-	return "transition canceled"
+	return msg
 }
 
 // AsyncError is returned by FSM.Event() when a callback have initiated an
@@ -75,10 +267,101 @@ func (e AsyncError) Error() string {
 	return "async started"
 }
 
+// ReentrantEventError is returned by FSM.Event() when it is called from a
+// callback of the same machine while another event is being processed, unless
+// reentrancy checking is disabled with the WithoutReentrancyCheck option.
+type ReentrantEventError struct {
+	Event string
+}
+
+func (e ReentrantEventError) Error() string {
+	return "event " + e.Event + " fired from a callback while another event is in progress"
+}
+
+// DuplicateInFlightError is returned by FSM.Event() when WithDedupeConcurrentEvents()
+// is set and the same event is already being processed by another goroutine.
+type DuplicateInFlightError struct {
+	Event string
+}
+
+func (e DuplicateInFlightError) Error() string {
+	return "event " + e.Event + " is already in flight"
+}
+
+// MacroError is returned by FSM.Event() when a step of a macro registered with
+// FSM.RegisterMacro() fails.
+type MacroError struct {
+	Macro string
+	Event string
+	Err   error
+}
+
+func (e MacroError) Error() string {
+	return "macro " + e.Macro + " failed at event " + e.Event + ": " + e.Err.Error()
+}
+
+func (e MacroError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownCallbackTargetError is returned by NewMachineChecked() when a callback
+// name does not refer to a known state, event or global callback.
+type UnknownCallbackTargetError struct {
+	Name string
+}
+
+func (e UnknownCallbackTargetError) Error() string {
+	return "callback " + e.Name + " does not match any state or event"
+}
+
+// TransientLoopError is returned by NewMachineChecked() when transient events
+// form a loop that would make the machine transition forever.
+type TransientLoopError struct {
+	States []string
+}
+
+func (e TransientLoopError) Error() string {
+	return "transient events form a loop: " + strings.Join(e.States, " -> ")
+}
+
+// TransientEventError is passed to FSM.OnError() hooks in Event.Err when a
+// transient event fired automatically after a committed transition fails.
+// The transition that entered State is not affected.
+type TransientEventError struct {
+	Event string
+	State string
+	Err   error
+}
+
+func (e TransientEventError) Error() string {
+	return "transient event " + e.Event + " from state " + e.State + " failed: " + e.Err.Error()
+}
+
+func (e TransientEventError) Unwrap() error {
+	return e.Err
+}
+
+// AlreadyStartedError is returned by FSM.Start() when the machine has already
+// been started.
+type AlreadyStartedError struct{}
+
+func (e AlreadyStartedError) Error() string {
+	return "machine already started"
+}
+
 // InternalError is returned by FSM.Event() and should never occur. It is a
-// probably because of a bug.
-type InternalError struct{}
+// probably because of a bug. Err is the underlying cause, if any.
+type InternalError struct {
+	Err error
+}
 
 func (e InternalError) Error() string {
+	if e.Err != nil {
+		return "internal error on state transition: " + e.Err.Error()
+	}
 	return "internal error on state transition"
 }
+
+func (e InternalError) Unwrap() error {
+	return e.Err
+}
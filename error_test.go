@@ -0,0 +1,93 @@
+package fsm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestInvalidEventErrorListsAvailable(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+
+	err := m.Event("finish")
+	invalid, ok := err.(InvalidEventError)
+	if !ok {
+		t.Fatalf("Event(finish) = %v, want InvalidEventError", err)
+	}
+	if want := []string{"scan", "situation"}; !reflect.DeepEqual(invalid.Available, want) {
+		t.Fatalf("Available = %v, want %v", invalid.Available, want)
+	}
+	if want := "event finish inappropriate in current state idle, available events: scan, situation"; err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+// failingTransitioner 总是返回 err, 不执行迁移
+type failingTransitioner struct {
+	err error
+}
+
+func (t failingTransitioner) transition(m *Machine) error {
+	return t.err
+}
+
+func TestInternalErrorWrapsCause(t *testing.T) {
+	errBroken := errors.New("transitioner broken")
+	m := NewMachine("idle", exampleEvents(), nil)
+	m.transitionerObj = failingTransitioner{errBroken}
+
+	err := m.Event("scan")
+	if _, ok := err.(InternalError); !ok {
+		t.Fatalf("Event(scan) = %v, want InternalError", err)
+	}
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("errors.Is(%v, errBroken) = false", err)
+	}
+}
+
+func TestOnErrorEnterCallbackError(t *testing.T) {
+	errEnter := errors.New("enter failed")
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_scanning": func(e *Event) { e.Err = errEnter },
+	})
+	var reported []*Event
+	m.OnError(func(e *Event) { reported = append(reported, e) })
+
+	if err := m.Event("scan"); err != errEnter {
+		t.Fatalf("Event(scan) = %v, want %v", err, errEnter)
+	}
+	if len(reported) != 1 {
+		t.Fatalf("OnError called %d times, want 1", len(reported))
+	}
+	if e := reported[0]; e.Event != "scan" || e.Err != errEnter {
+		t.Fatalf("OnError got event %q err %v, want scan and %v", e.Event, e.Err, errEnter)
+	}
+}
+
+func TestOnErrorInternalError(t *testing.T) {
+	errBroken := errors.New("transitioner broken")
+	m := NewMachine("idle", exampleEvents(), nil)
+	m.transitionerObj = failingTransitioner{errBroken}
+	var reported []error
+	m.OnError(func(e *Event) { reported = append(reported, e.Err) })
+
+	m.Event("scan")
+	if len(reported) != 1 {
+		t.Fatalf("OnError called %d times, want 1", len(reported))
+	}
+	if _, ok := reported[0].(InternalError); !ok {
+		t.Fatalf("OnError got %v, want InternalError", reported[0])
+	}
+}
+
+func TestOnErrorSkipsRejections(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	called := false
+	m.OnError(func(e *Event) { called = true })
+
+	m.Event("finish")
+	m.Event("situation")
+	if called {
+		t.Fatal("OnError should not fire for rejected events")
+	}
+}
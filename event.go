@@ -1,14 +1,30 @@
 package fsm
 
+import (
+	"context"
+	"sort"
+)
+
 type Event struct {
-	Machine  *Machine
-	Event    string
-	Src      string
-	Dst      string
-	Err      error
-	Args     []interface{}
-	canceled bool
-	async    bool
+	Machine *Machine
+	// ID 在同一个 Machine 内唯一且单调递增, 用于关联同一次事件的日志
+	ID    string
+	Event string
+	Src   string
+	Dst   string
+	Err   error
+	Args  []interface{}
+	Meta  map[string]interface{}
+	Ctx   context.Context
+	// PrevEvent 是上一次完成状态迁移的事件, 第一次迁移时为空
+	PrevEvent  string
+	canceled   bool
+	cancelCode string
+	async      bool
+	// redirectable 只在执行 before_event 回调期间为 true
+	redirectable bool
+	// deniedBy 是拒绝迁移的组合守卫路径
+	deniedBy string
 }
 
 func (e *Event) Cancel(err ...error) {
@@ -18,6 +34,38 @@ func (e *Event) Cancel(err ...error) {
 	}
 }
 
+// CancelWithReason 与 Cancel 相同, 额外记录一个取消原因代码,
+// 该代码会通过返回的 CanceledError 传递给调用方, 便于审计日志定位是哪个回调取消了迁移
+func (e *Event) CancelWithReason(code string, err error) {
+	e.canceled = true
+	e.cancelCode = code
+	e.Err = err
+}
+
+// Redirect 在 before_event 回调中修改迁移的目标状态
+// dst 必须是该事件在定义中(任意源状态下)声明过的目标状态, 否则返回 InvalidRedirectError
+func (e *Event) Redirect(dst string) error {
+	if !e.redirectable {
+		return InvalidRedirectError{Event: e.Event, Dst: dst}
+	}
+	for key, declared := range e.Machine.transitions {
+		if key.event == e.Event && declared == dst {
+			e.Dst = dst
+			return nil
+		}
+	}
+	return InvalidRedirectError{Event: e.Event, Dst: dst}
+}
+
+// Value 返回 e.Ctx 中 key 对应的值, 用于在回调中读取请求范围的数据(用户 ID, trace ID 等)
+// e.Ctx 为 nil 时返回 nil
+func (e *Event) Value(key interface{}) interface{} {
+	if e.Ctx == nil {
+		return nil
+	}
+	return e.Ctx.Value(key)
+}
+
 func (e *Event) Async() {
 	e.async = true
 }
@@ -26,3 +74,21 @@ type eKey struct {
 	event string
 	src   string
 }
+
+/**
+AllEvents: 返回迁移表中定义的所有事件(已排序)
+*/
+func (m *Machine) AllEvents() []string {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	seen := make(map[string]bool)
+	events := make([]string, 0, len(m.transitions))
+	for key := range m.transitions {
+		if !seen[key.event] {
+			seen[key.event] = true
+			events = append(events, key.event)
+		}
+	}
+	sort.Strings(events)
+	return events
+}
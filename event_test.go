@@ -0,0 +1,192 @@
+package fsm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCancelWithReasonPropagatesCode(t *testing.T) {
+	errQuota := errors.New("quota exceeded")
+	for _, name := range []string{"before_scan", "leave_idle"} {
+		m := NewMachine("idle", exampleEvents(), Callbacks{
+			name: func(e *Event) { e.CancelWithReason("quota", errQuota) },
+		})
+
+		err := m.Event("scan")
+		canceled, ok := err.(CanceledError)
+		if !ok || canceled.Code != "quota" || canceled.Err != errQuota {
+			t.Fatalf("%s: Event(scan) = %#v, want CanceledError with code quota", name, err)
+		}
+		if want := "transition canceled (quota) with error: quota exceeded"; err.Error() != want {
+			t.Fatalf("%s: Error() = %q, want %q", name, err.Error(), want)
+		}
+		if m.Current() != "idle" {
+			t.Fatalf("%s: Current() = %q, want idle", name, m.Current())
+		}
+	}
+}
+
+func TestCancelWithoutReason(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan": func(e *Event) { e.Cancel() },
+	})
+
+	err := m.Event("scan")
+	if canceled, ok := err.(CanceledError); !ok || canceled.Code != "" {
+		t.Fatalf("Event(scan) = %#v, want CanceledError without code", err)
+	}
+	if err.Error() != "transition canceled" {
+		t.Fatalf("Error() = %q, want %q", err.Error(), "transition canceled")
+	}
+}
+
+// reviewEvents 中 review 事件声明了两个目标状态
+func reviewEvents() Events {
+	return Events{
+		{Name: "review", Src: []string{"pending"}, Dst: "approved"},
+		{Name: "review", Src: []string{"flagged"}, Dst: "rejected"},
+		{Name: "archive", Src: []string{"approved", "rejected"}, Dst: "archived"},
+	}
+}
+
+func TestRedirectToDeclaredDestination(t *testing.T) {
+	var entered string
+	m := NewMachine("pending", reviewEvents(), Callbacks{
+		"before_review": func(e *Event) {
+			if err := e.Redirect("rejected"); err != nil {
+				t.Errorf("Redirect(rejected) = %v", err)
+			}
+		},
+		"enter_state": func(e *Event) { entered = e.Dst },
+	})
+
+	if err := m.Event("review"); err != nil {
+		t.Fatalf("Event(review) = %v", err)
+	}
+	if m.Current() != "rejected" || entered != "rejected" {
+		t.Fatalf("after redirect: state %q, entered %q; want rejected", m.Current(), entered)
+	}
+}
+
+func TestRedirectRejectsUndeclaredDestination(t *testing.T) {
+	var errs []error
+	m := NewMachine("pending", reviewEvents(), Callbacks{
+		"before_review": func(e *Event) { errs = append(errs, e.Redirect("archived")) },
+		"leave_pending": func(e *Event) { errs = append(errs, e.Redirect("rejected")) },
+	})
+
+	if err := m.Event("review"); err != nil {
+		t.Fatalf("Event(review) = %v", err)
+	}
+	// archived 不是 review 的目标状态; leave 回调中不允许重定向
+	want := []error{
+		InvalidRedirectError{Event: "review", Dst: "archived"},
+		InvalidRedirectError{Event: "review", Dst: "rejected"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("Redirect errors = %v, want %v", errs, want)
+	}
+	if m.Current() != "approved" {
+		t.Fatalf("Current() = %q, want approved", m.Current())
+	}
+}
+
+// userKey 是测试中放入 context 的键类型
+type userKey struct{}
+
+func TestEventValueReadsContext(t *testing.T) {
+	var user interface{}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan": func(e *Event) { user = e.Value(userKey{}) },
+	})
+
+	ctx := context.WithValue(context.Background(), userKey{}, "alice")
+	if err := m.EventContext(ctx, "scan"); err != nil {
+		t.Fatalf("EventContext(scan) = %v", err)
+	}
+	if user != "alice" {
+		t.Fatalf("e.Value(userKey) = %v, want alice", user)
+	}
+
+	if v := (&Event{}).Value(userKey{}); v != nil {
+		t.Fatalf("Value on an Event without Ctx = %v, want nil", v)
+	}
+}
+
+func TestEventIDUniqueAndMonotonic(t *testing.T) {
+	var buf bytes.Buffer
+	var ids []string
+	record := func(e *Event) { ids = append(ids, e.ID) }
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_event": record,
+		"after_event":  record,
+	}, WithJSONLogger(&buf))
+
+	for _, event := range []string{"scan", "working", "finish", "scan"} {
+		m.Event(event)
+	}
+
+	// 同一次事件的各回调看到相同的 ID
+	var perEvent []string
+	for i := 0; i < len(ids); i += 2 {
+		if ids[i] != ids[i+1] {
+			t.Fatalf("before_event saw %q but after_event saw %q", ids[i], ids[i+1])
+		}
+		perEvent = append(perEvent, ids[i])
+	}
+	prev := uint64(0)
+	for _, id := range perEvent {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || n <= prev {
+			t.Fatalf("IDs %v are not unique and monotonic", perEvent)
+		}
+		prev = n
+	}
+
+	var logged []string
+	for _, record := range decodeLogs(t, &buf) {
+		logged = append(logged, record.ID)
+	}
+	if !reflect.DeepEqual(logged, perEvent) {
+		t.Fatalf("logged IDs = %v, want %v", logged, perEvent)
+	}
+}
+
+func TestArgsTransformerRewritesArgs(t *testing.T) {
+	var seen [][]interface{}
+	record := func(e *Event) { seen = append(seen, e.Args) }
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan":    record,
+		"enter_scanning": record,
+		"after_scan":     record,
+	})
+	var calls []string
+	m.SetArgsTransformer(func(event string, args []interface{}) []interface{} {
+		calls = append(calls, event)
+		return append([]interface{}{"logger"}, args...)
+	})
+
+	if err := m.Event("scan", 1); err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+	if want := []string{"scan"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("transformer called for %v, want %v", calls, want)
+	}
+	want := [][]interface{}{{"logger", 1}, {"logger", 1}, {"logger", 1}}
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("callback args = %v, want %v", seen, want)
+	}
+
+	// 设置为 nil 后取消转换
+	m.SetArgsTransformer(nil)
+	seen = nil
+	m.Event("finish")
+	m.Event("scan", 2)
+	if want := [][]interface{}{{2}, {2}, {2}}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("callback args without transformer = %v, want %v", seen, want)
+	}
+}
@@ -0,0 +1,72 @@
+// Package fsmtest 提供在测试中检查 fsm.Machine 的辅助函数
+package fsmtest
+
+import (
+	"github.com/qisanyijiu/fsm"
+)
+
+// TestingT 是 *testing.T 中这里用到的方法, 便于替换为假实现
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+/**
+AssertState: 断言当前状态为 want
+*/
+func AssertState(t TestingT, m *fsm.Machine, want string) bool {
+	t.Helper()
+	if got := m.Current(); got != want {
+		t.Errorf("fsm: expected state %q, got %q (available events: %v)", want, got, m.AvailableTransitions())
+		return false
+	}
+	return true
+}
+
+/**
+AssertCan: 断言当前状态下可以执行 event
+*/
+func AssertCan(t TestingT, m *fsm.Machine, event string) bool {
+	t.Helper()
+	if !m.Can(event) {
+		t.Errorf("fsm: expected event %q to be possible in state %q (available events: %v)",
+			event, m.Current(), m.AvailableTransitions())
+		return false
+	}
+	return true
+}
+
+/**
+AssertCannot: 断言当前状态下不能执行 event
+*/
+func AssertCannot(t TestingT, m *fsm.Machine, event string) bool {
+	t.Helper()
+	if m.Can(event) {
+		t.Errorf("fsm: expected event %q to be impossible in state %q (available events: %v)",
+			event, m.Current(), m.AvailableTransitions())
+		return false
+	}
+	return true
+}
+
+/**
+AssertTransition: 执行 event 并断言之后的状态为 wantState
+自迁移返回的 NoTransitionError 不视为失败
+*/
+func AssertTransition(t TestingT, m *fsm.Machine, event string, wantState string) bool {
+	t.Helper()
+	from := m.Current()
+	if err := m.Event(event); err != nil {
+		if _, ok := err.(fsm.NoTransitionError); !ok {
+			t.Errorf("fsm: event %q from state %q failed: %v (available events: %v)",
+				event, from, err, m.AvailableTransitions())
+			return false
+		}
+	}
+	if got := m.Current(); got != wantState {
+		t.Errorf("fsm: event %q from state %q: expected state %q, got %q (available events: %v)",
+			event, from, wantState, got, m.AvailableTransitions())
+		return false
+	}
+	return true
+}
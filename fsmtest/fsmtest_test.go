@@ -0,0 +1,92 @@
+package fsmtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/qisanyijiu/fsm"
+)
+
+// fakeT 记录 Errorf 的输出, 用于检查辅助函数的失败信息
+type fakeT struct {
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func newMachine() *fsm.Machine {
+	return fsm.NewMachine("idle", fsm.Events{
+		{Name: "scan", Src: []string{"idle"}, Dst: "scanning"},
+		{Name: "working", Src: []string{"scanning"}, Dst: "scanning"},
+		{Name: "finish", Src: []string{"scanning"}, Dst: "idle"},
+	}, nil)
+}
+
+// check 断言 ok 与 wantOK 一致, 失败时恰好报告一次且信息包含 wantMsg
+func check(t *testing.T, f *fakeT, ok, wantOK bool, wantMsg string) {
+	t.Helper()
+	if ok != wantOK {
+		t.Fatalf("helper returned %v, want %v", ok, wantOK)
+	}
+	if wantOK {
+		if len(f.errors) != 0 {
+			t.Fatalf("unexpected errors: %v", f.errors)
+		}
+		return
+	}
+	if len(f.errors) != 1 || !strings.Contains(f.errors[0], wantMsg) {
+		t.Fatalf("errors = %v, want one containing %q", f.errors, wantMsg)
+	}
+}
+
+func TestAssertState(t *testing.T) {
+	m := newMachine()
+
+	f := &fakeT{}
+	check(t, f, AssertState(f, m, "idle"), true, "")
+
+	f = &fakeT{}
+	check(t, f, AssertState(f, m, "scanning"), false, `expected state "scanning", got "idle" (available events: [scan])`)
+}
+
+func TestAssertCan(t *testing.T) {
+	m := newMachine()
+
+	f := &fakeT{}
+	check(t, f, AssertCan(f, m, "scan"), true, "")
+
+	f = &fakeT{}
+	check(t, f, AssertCan(f, m, "finish"), false, `expected event "finish" to be possible in state "idle"`)
+}
+
+func TestAssertCannot(t *testing.T) {
+	m := newMachine()
+
+	f := &fakeT{}
+	check(t, f, AssertCannot(f, m, "finish"), true, "")
+
+	f = &fakeT{}
+	check(t, f, AssertCannot(f, m, "scan"), false, `expected event "scan" to be impossible in state "idle" (available events: [scan])`)
+}
+
+func TestAssertTransition(t *testing.T) {
+	m := newMachine()
+
+	f := &fakeT{}
+	check(t, f, AssertTransition(f, m, "scan", "scanning"), true, "")
+
+	// 自迁移返回的 NoTransitionError 不视为失败
+	f = &fakeT{}
+	check(t, f, AssertTransition(f, m, "working", "scanning"), true, "")
+
+	f = &fakeT{}
+	check(t, f, AssertTransition(f, m, "scan", "scanning"), false, `event "scan" from state "scanning" failed`)
+
+	f = &fakeT{}
+	check(t, f, AssertTransition(f, m, "finish", "scanning"), false, `expected state "scanning", got "idle"`)
+}
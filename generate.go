@@ -0,0 +1,86 @@
+package fsm
+
+import (
+	"bytes"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/**
+GenerateConstants: 生成包 pkg 的 Go 源码, 为定义中的每个状态和事件声明字符串常量
+例如 StateIdle = "idle", EventScan = "scan"; 名字不同的字符串生成相同的标识符时返回错误
+*/
+func GenerateConstants(pkg string, initial string, events []EventDesc, w io.Writer) error {
+	stateSet := map[string]bool{initial: true}
+	eventSet := make(map[string]bool)
+	for _, e := range events {
+		eventSet[e.Name] = true
+		for _, src := range e.Src {
+			stateSet[src] = true
+			if !isSelfDst(e.Dst) {
+				stateSet[e.Dst] = true
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by fsm.GenerateConstants. DO NOT EDIT.\n\n")
+	buf.WriteString("package " + pkg + "\n\n")
+	if err := writeConstants(&buf, "State", stateSet); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	if err := writeConstants(&buf, "Event", eventSet); err != nil {
+		return err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// writeConstants 把 names 写成以 prefix 开头的常量块
+func writeConstants(buf *bytes.Buffer, prefix string, names map[string]bool) error {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	used := make(map[string]string)
+	buf.WriteString("const (\n")
+	for _, name := range sorted {
+		ident := prefix + goIdentifier(name)
+		if other, ok := used[ident]; ok {
+			return IdentifierCollisionError{Identifier: ident, Names: []string{other, name}}
+		}
+		used[ident] = name
+		buf.WriteString("\t" + ident + " = " + strconv.Quote(name) + "\n")
+	}
+	buf.WriteString(")\n")
+	return nil
+}
+
+// goIdentifier 把 s 转换为驼峰形式的导出标识符, 非字母数字的字符作为单词分隔符
+func goIdentifier(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package fsm
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// parseConstants 解析生成的源码, 返回常量名到值的映射
+func parseConstants(t *testing.T, src []byte) map[string]string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "constants.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	consts := make(map[string]string)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			value, err := strconv.Unquote(vs.Values[0].(*ast.BasicLit).Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			consts[vs.Names[0].Name] = value
+		}
+	}
+	return consts
+}
+
+func TestGenerateConstants(t *testing.T) {
+	events := append(exampleEvents(), EventDesc{Name: "shut-down", Src: []string{"idle"}, Dst: "power_off"})
+	var buf bytes.Buffer
+	if err := GenerateConstants("states", "idle", events, &buf); err != nil {
+		t.Fatalf("GenerateConstants() error = %v", err)
+	}
+
+	want := map[string]string{
+		"StateIdle":      "idle",
+		"StateScanning":  "scanning",
+		"StatePowerOff":  "power_off",
+		"EventScan":      "scan",
+		"EventWorking":   "working",
+		"EventSituation": "situation",
+		"EventFinish":    "finish",
+		"EventShutDown":  "shut-down",
+	}
+	if got := parseConstants(t, buf.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("constants = %v, want %v", got, want)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("package states\n")) {
+		t.Fatalf("generated source missing package clause:\n%s", buf.Bytes())
+	}
+}
+
+func TestGenerateConstantsCollision(t *testing.T) {
+	events := Events{
+		{Name: "go", Src: []string{"power_off"}, Dst: "power-off"},
+	}
+	err := GenerateConstants("states", "power_off", events, &bytes.Buffer{})
+	collision, ok := err.(IdentifierCollisionError)
+	if !ok {
+		t.Fatalf("GenerateConstants() = %v, want IdentifierCollisionError", err)
+	}
+	if collision.Identifier != "StatePowerOff" {
+		t.Fatalf("Identifier = %q, want StatePowerOff", collision.Identifier)
+	}
+}
@@ -0,0 +1,26 @@
+package fsm
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+)
+
+// stackBufs 复用 goroutineID 读取调用栈的缓冲区, runtime.Stack 会使缓冲区逃逸到堆上
+var stackBufs = sync.Pool{New: func() interface{} { return new([64]byte) }}
+
+// goroutineID 从调用栈信息中解析出当前 goroutine 的 ID, 仅用于检测误用
+func goroutineID() int64 {
+	buf := stackBufs.Get().(*[64]byte)
+	defer stackBufs.Put(buf)
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	var id int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + int64(c-'0')
+	}
+	return id
+}
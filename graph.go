@@ -0,0 +1,372 @@
+package fsm
+
+import "sort"
+
+/**
+Cycles: 返回状态迁移图中所有非平凡的强连通分量(Tarjan 算法)
+每个分量按状态名排序, 只有一个状态且没有自环的分量不算作环
+*/
+func (m *Machine) Cycles() [][]string {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+
+	graph := make(map[string][]string)
+	selfLoop := make(map[string]bool)
+	for key, dst := range m.transitions {
+		graph[key.src] = append(graph[key.src], dst)
+		if _, ok := graph[dst]; !ok {
+			graph[dst] = nil
+		}
+		if key.src == dst {
+			selfLoop[dst] = true
+		}
+	}
+
+	states := make([]string, 0, len(graph))
+	for state, next := range graph {
+		sort.Strings(next)
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	index := 0
+	indices := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	cycles := [][]string{}
+
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		indices[v] = index
+		lowLink[v] = index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range graph[v] {
+			if _, visited := indices[w]; !visited {
+				strongConnect(w)
+				if lowLink[w] < lowLink[v] {
+					lowLink[v] = lowLink[w]
+				}
+			} else if onStack[w] && indices[w] < lowLink[v] {
+				lowLink[v] = indices[w]
+			}
+		}
+
+		if lowLink[v] != indices[v] {
+			return
+		}
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop[v] {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	for _, state := range states {
+		if _, visited := indices[state]; !visited {
+			strongConnect(state)
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
+
+/**
+AdjacencyMatrix: 以邻接矩阵的形式导出状态迁移表
+states 为排序后的状态列表, matrix[i][j] 为从 states[i] 迁移到 states[j] 的不同事件个数
+*/
+func (m *Machine) AdjacencyMatrix() (states []string, matrix [][]int) {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+
+	states = m.sortedStates()
+	position := make(map[string]int, len(states))
+	for i, state := range states {
+		position[state] = i
+	}
+
+	matrix = make([][]int, len(states))
+	for i := range matrix {
+		matrix[i] = make([]int, len(states))
+	}
+	for key, dst := range m.transitions {
+		matrix[position[key.src]][position[dst]]++
+	}
+	return states, matrix
+}
+
+// sortedStates 返回迁移表中出现过的所有状态, 调用方需持有 stateMu
+func (m *Machine) sortedStates() []string {
+	seen := make(map[string]bool)
+	for key, dst := range m.transitions {
+		seen[key.src] = true
+		seen[dst] = true
+	}
+	states := make([]string, 0, len(seen))
+	for state := range seen {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+/**
+AllTransitions: 返回遍历所有状态迁移的迭代器
+模块仍以 go 1.13 构建, 无法引用 iter 包, 返回值的签名与 Go 1.23 的 iter.Seq[Transition] 相同, 可直接用于 range-over-func;
+调用时会在读锁下把全部迁移复制为一个排序后的快照, 因此并不能省去整表的分配,
+但循环体中可以安全地调用 Machine 的其他方法
+*/
+func (m *Machine) AllTransitions() func(yield func(Transition) bool) {
+	m.stateMu.RLock()
+	snapshot := m.sortedTransitions()
+	m.stateMu.RUnlock()
+
+	return func(yield func(Transition) bool) {
+		for _, t := range snapshot {
+			if !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+/**
+Edges: 返回所有状态迁移, 与当前状态无关, 按 (Event, Src) 排序
+*/
+func (m *Machine) Edges() []Transition {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.sortedTransitions()
+}
+
+/**
+IncomingTransitions: 返回所有以 state 为目标状态的迁移, 按 (Event, Src) 排序
+*/
+func (m *Machine) IncomingTransitions(state string) []Transition {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	var incoming []Transition
+	for _, t := range m.sortedTransitions() {
+		if t.Dst == state {
+			incoming = append(incoming, t)
+		}
+	}
+	return incoming
+}
+
+/**
+SelfTransitions: 返回所有源状态与目标状态相同的迁移(自迁移), 按 (Event, Src) 排序
+*/
+func (m *Machine) SelfTransitions() []Transition {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	var self []Transition
+	for _, t := range m.sortedTransitions() {
+		if t.Src == t.Dst {
+			self = append(self, t)
+		}
+	}
+	return self
+}
+
+/**
+ReverseAmbiguities: 返回同一事件从多个源状态到达同一目标状态的迁移, 按 (Event, Src) 排序
+这些迁移无法被唯一地反向, 非空时 ReverseDefinition 的结果只保留其中一个源状态
+*/
+func (m *Machine) ReverseAmbiguities() []Transition {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	sources := make(map[eKey]int)
+	for key, dst := range m.transitions {
+		sources[eKey{key.event, dst}]++
+	}
+	var ambiguous []Transition
+	for _, t := range m.sortedTransitions() {
+		if sources[eKey{t.Event, t.Dst}] > 1 {
+			ambiguous = append(ambiguous, t)
+		}
+	}
+	return ambiguous
+}
+
+// sortedTransitions 返回按 (Event, Src) 排序的所有迁移, 调用方需持有 stateMu
+func (m *Machine) sortedTransitions() []Transition {
+	transitions := make([]Transition, 0, len(m.transitions))
+	for key, dst := range m.transitions {
+		transitions = append(transitions, Transition{Event: key.event, Src: key.src, Dst: dst})
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		if transitions[i].Event != transitions[j].Event {
+			return transitions[i].Event < transitions[j].Event
+		}
+		return transitions[i].Src < transitions[j].Src
+	})
+	return transitions
+}
+
+/**
+EqualDefinitions: 比较两个 Machine 的初始状态和迁移表是否相同, 忽略回调和定义的顺序
+*/
+func EqualDefinitions(a, b *Machine) bool {
+	a.stateMu.RLock()
+	defer a.stateMu.RUnlock()
+	b.stateMu.RLock()
+	defer b.stateMu.RUnlock()
+
+	if a.initial != b.initial || len(a.transitions) != len(b.transitions) {
+		return false
+	}
+	for key, dst := range a.transitions {
+		if other, ok := b.transitions[key]; !ok || other != dst {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+TopoSort: 返回状态的拓扑排序, 同一层级的状态按名字排序, 自环不影响排序
+存在环时返回 CycleError 指出其中一个环, 同时返回按名字排序的全部状态作为备用顺序
+*/
+func (m *Machine) TopoSort() ([]string, error) {
+	m.stateMu.RLock()
+	states := m.sortedStates()
+	inDegree := make(map[string]int, len(states))
+	next := make(map[string][]string)
+	seen := make(map[Transition]bool)
+	for key, dst := range m.transitions {
+		edge := Transition{Src: key.src, Dst: dst}
+		if key.src == dst || seen[edge] {
+			continue
+		}
+		seen[edge] = true
+		next[key.src] = append(next[key.src], dst)
+		inDegree[dst]++
+	}
+	m.stateMu.RUnlock()
+
+	var ready []string
+	for _, state := range states {
+		if inDegree[state] == 0 {
+			ready = append(ready, state)
+		}
+	}
+	order := make([]string, 0, len(states))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		state := ready[0]
+		ready = ready[1:]
+		order = append(order, state)
+		for _, dst := range next[state] {
+			inDegree[dst]--
+			if inDegree[dst] == 0 {
+				ready = append(ready, dst)
+			}
+		}
+	}
+
+	if len(order) < len(states) {
+		for _, cycle := range m.Cycles() {
+			if len(cycle) > 1 {
+				return states, CycleError{States: cycle}
+			}
+		}
+	}
+	return order, nil
+}
+
+/**
+ReverseDefinition: 返回 events 的反向定义, 每条迁移的源状态和目标状态互换, 事件名加上 "undo_" 前缀
+用于为回滚流程构造配套的 Machine; 只有正向图是确定的(每个状态经由同一事件只从一个源状态到达)时反向才有意义,
+否则同一反向事件在同一状态下有多个目标, 只保留定义中出现的第一个
+*/
+func ReverseDefinition(events []EventDesc) []EventDesc {
+	return ReverseDefinitionWith(events, func(name string) string {
+		return "undo_" + name
+	})
+}
+
+/**
+ReverseDefinitionWith: 与 ReverseDefinition 相同, 反向事件名由 rename 生成
+结果保留 Meta 和 ArgCount, 不保留 Transient 和 Priority
+*/
+func ReverseDefinitionWith(events []EventDesc, rename func(name string) string) []EventDesc {
+	var reversed []EventDesc
+	index := make(map[eKey]int)
+	seen := make(map[eKey]bool)
+	for _, e := range events {
+		name := rename(e.Name)
+		for _, src := range e.Src {
+			newSrc, newDst := e.Dst, src
+			if isSelfDst(e.Dst) {
+				newSrc, newDst = src, e.Dst
+			}
+			if seen[eKey{name, newSrc}] {
+				continue
+			}
+			seen[eKey{name, newSrc}] = true
+			if i, ok := index[eKey{name, newDst}]; ok {
+				reversed[i].Src = append(reversed[i].Src, newSrc)
+				continue
+			}
+			index[eKey{name, newDst}] = len(reversed)
+			reversed = append(reversed, EventDesc{
+				Name:     name,
+				Src:      []string{newSrc},
+				Dst:      newDst,
+				Meta:     e.Meta,
+				ArgCount: e.ArgCount,
+			})
+		}
+	}
+	return reversed
+}
+
+/**
+ReachableStates: 返回从初始状态出发可以到达的所有状态(包括初始状态)
+结果会被缓存, AddTransition/RemoveTransition 修改迁移表后重新计算
+*/
+func (m *Machine) ReachableStates() map[string]bool {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	if m.reachable == nil {
+		next := make(map[string][]string)
+		for key, dst := range m.transitions {
+			next[key.src] = append(next[key.src], dst)
+		}
+		m.reachable = map[string]bool{m.initial: true}
+		queue := []string{m.initial}
+		for len(queue) > 0 {
+			state := queue[0]
+			queue = queue[1:]
+			for _, dst := range next[state] {
+				if !m.reachable[dst] {
+					m.reachable[dst] = true
+					queue = append(queue, dst)
+				}
+			}
+		}
+	}
+
+	reachable := make(map[string]bool, len(m.reachable))
+	for state := range m.reachable {
+		reachable[state] = true
+	}
+	return reachable
+}
@@ -0,0 +1,291 @@
+package fsm
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// exampleEdges 是 exampleEvents 按 (Event, Src) 排序后的所有迁移
+func exampleEdges() []Transition {
+	return []Transition{
+		{Event: "finish", Src: "scanning", Dst: "idle"},
+		{Event: "scan", Src: "idle", Dst: "scanning"},
+		{Event: "situation", Src: "idle", Dst: "idle"},
+		{Event: "situation", Src: "scanning", Dst: "scanning"},
+		{Event: "working", Src: "scanning", Dst: "scanning"},
+	}
+}
+
+func TestAllTransitionsMatchesDefinition(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+
+	var got []Transition
+	m.AllTransitions()(func(tr Transition) bool {
+		got = append(got, tr)
+		return true
+	})
+	if want := exampleEdges(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("AllTransitions yielded %v, want %v", got, want)
+	}
+}
+
+func TestAllTransitionsEarlyBreak(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+
+	var got []Transition
+	m.AllTransitions()(func(tr Transition) bool {
+		got = append(got, tr)
+		return len(got) < 2
+	})
+	if len(got) != 2 {
+		t.Fatalf("yield called %d times after returning false, want 2", len(got))
+	}
+}
+
+func TestAllTransitionsAllowsMachineCalls(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	seq := m.AllTransitions()
+
+	// 循环体中调用 Machine 的其他方法不会死锁
+	var n int
+	seq(func(tr Transition) bool {
+		n++
+		m.Can(tr.Event)
+		return true
+	})
+	if n != 5 {
+		t.Fatalf("yielded %d transitions, want 5", n)
+	}
+}
+
+func TestCyclesFindsComponents(t *testing.T) {
+	m := NewMachine("a", Events{
+		{Name: "next", Src: []string{"a"}, Dst: "b"},
+		{Name: "next", Src: []string{"b"}, Dst: "c"},
+		{Name: "back", Src: []string{"c"}, Dst: "a"},
+		{Name: "out", Src: []string{"c"}, Dst: "d"},
+		{Name: "retry", Src: []string{"e"}, Dst: "e"},
+		{Name: "out", Src: []string{"d"}, Dst: "e"},
+	}, nil)
+
+	want := [][]string{{"a", "b", "c"}, {"e"}}
+	if got := m.Cycles(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Cycles() = %v, want %v", got, want)
+	}
+}
+
+func TestCyclesAcyclic(t *testing.T) {
+	m := NewMachine("a", Events{
+		{Name: "next", Src: []string{"a"}, Dst: "b"},
+		{Name: "next", Src: []string{"b"}, Dst: "c"},
+		{Name: "skip", Src: []string{"a"}, Dst: "c"},
+	}, nil)
+
+	if got := m.Cycles(); got == nil || len(got) != 0 {
+		t.Fatalf("Cycles() = %#v, want empty slice", got)
+	}
+}
+
+func TestAdjacencyMatrix(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+
+	states, matrix := m.AdjacencyMatrix()
+	if want := []string{"idle", "scanning"}; !reflect.DeepEqual(states, want) {
+		t.Fatalf("states = %v, want %v", states, want)
+	}
+	// 对角线是自环: idle 上的 situation, scanning 上的 working 和 situation
+	want := [][]int{
+		{1, 1},
+		{1, 2},
+	}
+	if !reflect.DeepEqual(matrix, want) {
+		t.Fatalf("matrix = %v, want %v", matrix, want)
+	}
+}
+
+func TestEdgesIndependentOfCurrentState(t *testing.T) {
+	for _, state := range []string{"idle", "scanning"} {
+		m := NewMachine(state, exampleEvents(), nil)
+		if got, want := m.Edges(), exampleEdges(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Edges() in %s = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestEqualDefinitions(t *testing.T) {
+	base := NewMachine("idle", exampleEvents(), nil)
+
+	// 顺序不同, 并且把 situation 的两个源状态写在同一个 EventDesc 中
+	reordered := NewMachine("idle", Events{
+		{Name: "finish", Src: []string{"scanning"}, Dst: "idle"},
+		{Name: "situation", Src: []string{"scanning", "idle"}, Dst: "="},
+		{Name: "working", Src: []string{"scanning"}, Dst: "scanning"},
+		{Name: "scan", Src: []string{"idle"}, Dst: "scanning"},
+	}, Callbacks{"enter_state": func(e *Event) {}})
+	if !EqualDefinitions(base, reordered) {
+		t.Fatalf("EqualDefinitions = false for reordered definitions")
+	}
+
+	if EqualDefinitions(base, NewMachine("scanning", exampleEvents(), nil)) {
+		t.Fatalf("EqualDefinitions = true for different initial states")
+	}
+	changed := exampleEvents()
+	changed[len(changed)-1].Dst = "scanning"
+	if EqualDefinitions(base, NewMachine("idle", changed, nil)) {
+		t.Fatalf("EqualDefinitions = true for a different destination")
+	}
+	if EqualDefinitions(base, NewMachine("idle", exampleEvents()[:4], nil)) {
+		t.Fatalf("EqualDefinitions = true for a missing transition")
+	}
+}
+
+func TestIncomingTransitions(t *testing.T) {
+	m := NewMachine("scanning", exampleEvents(), nil)
+
+	want := []Transition{
+		{Event: "finish", Src: "scanning", Dst: "idle"},
+		{Event: "situation", Src: "idle", Dst: "idle"},
+	}
+	if got := m.IncomingTransitions("idle"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("IncomingTransitions(idle) = %v, want %v", got, want)
+	}
+	if got := m.IncomingTransitions("missing"); len(got) != 0 {
+		t.Fatalf("IncomingTransitions(missing) = %v, want none", got)
+	}
+}
+
+func TestTopoSortAcyclic(t *testing.T) {
+	m := NewMachine("draft", Events{
+		{Name: "submit", Src: []string{"draft"}, Dst: "review"},
+		{Name: "reject", Src: []string{"review"}, Dst: "closed"},
+		{Name: "approve", Src: []string{"review"}, Dst: "approved"},
+		{Name: "publish", Src: []string{"approved"}, Dst: "closed"},
+		{Name: "edit", Src: []string{"draft"}, Dst: "draft"},
+	}, Callbacks{})
+
+	order, err := m.TopoSort()
+	if err != nil {
+		t.Fatalf("TopoSort() error = %v", err)
+	}
+	want := []string{"draft", "review", "approved", "closed"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("TopoSort() = %v, want %v", order, want)
+	}
+}
+
+func TestTopoSortCyclic(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), Callbacks{})
+
+	order, err := m.TopoSort()
+	cycleErr, ok := err.(CycleError)
+	if !ok {
+		t.Fatalf("TopoSort() error = %v, want CycleError", err)
+	}
+	// 环为 idle -> scanning -> idle, 自环不计
+	states := append([]string(nil), cycleErr.States...)
+	sort.Strings(states)
+	if !reflect.DeepEqual(states, []string{"idle", "scanning"}) {
+		t.Fatalf("CycleError.States = %v, want idle and scanning", cycleErr.States)
+	}
+	// 备用顺序为按名字排序的全部状态
+	if !reflect.DeepEqual(order, []string{"idle", "scanning"}) {
+		t.Fatalf("TopoSort() fallback = %v, want [idle scanning]", order)
+	}
+}
+
+func TestReverseDefinition(t *testing.T) {
+	events := Events{
+		{Name: "submit", Src: []string{"draft"}, Dst: "review"},
+		{Name: "approve", Src: []string{"review"}, Dst: "approved"},
+		{Name: "close", Src: []string{"draft", "review"}, Dst: "closed"},
+	}
+	want := []EventDesc{
+		{Name: "undo_submit", Src: []string{"review"}, Dst: "draft"},
+		{Name: "undo_approve", Src: []string{"approved"}, Dst: "review"},
+		// closed 经由 close 从两个源状态到达, 正向图不确定, 只保留第一个
+		{Name: "undo_close", Src: []string{"closed"}, Dst: "draft"},
+	}
+	if got := ReverseDefinition(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReverseDefinition() = %+v, want %+v", got, want)
+	}
+
+	m := NewMachine("approved", ReverseDefinition(events), nil)
+	m.Event("undo_approve")
+	m.Event("undo_submit")
+	if m.Current() != "draft" {
+		t.Fatalf("Current() after undo = %q, want draft", m.Current())
+	}
+}
+
+func TestReverseDefinitionWith(t *testing.T) {
+	events := Events{{Name: "submit", Src: []string{"draft"}, Dst: "review"}}
+	got := ReverseDefinitionWith(events, func(name string) string { return name + "_back" })
+	want := []EventDesc{{Name: "submit_back", Src: []string{"review"}, Dst: "draft"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReverseDefinitionWith() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReachableStates(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	want := map[string]bool{"idle": true, "scanning": true}
+	if got := m.ReachableStates(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReachableStates() = %v, want %v", got, want)
+	}
+}
+
+func TestReachableStatesInvalidatedByTransitionChanges(t *testing.T) {
+	events := append(exampleEvents(), EventDesc{Name: "wake", Src: []string{"sleeping"}, Dst: "idle"})
+	m := NewMachine("idle", events, nil)
+	if m.ReachableStates()["sleeping"] {
+		t.Fatal("sleeping should not be reachable before AddTransition")
+	}
+	if errs := m.Validate(); !reflect.DeepEqual(errs, []error{UnreachableStateError{State: "sleeping"}}) {
+		t.Fatalf("Validate() = %v, want UnreachableStateError for sleeping", errs)
+	}
+
+	m.AddTransition("sleep", "idle", "sleeping")
+	if !m.ReachableStates()["sleeping"] {
+		t.Fatal("sleeping should be reachable after AddTransition")
+	}
+	if errs := m.Validate(); len(errs) != 0 {
+		t.Fatalf("Validate() = %v, want no errors", errs)
+	}
+
+	m.RemoveTransition("sleep", "idle")
+	if m.ReachableStates()["sleeping"] {
+		t.Fatal("sleeping should not be reachable after RemoveTransition")
+	}
+}
+
+func TestSelfTransitions(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	want := []Transition{
+		{Event: "situation", Src: "idle", Dst: "idle"},
+		{Event: "situation", Src: "scanning", Dst: "scanning"},
+		{Event: "working", Src: "scanning", Dst: "scanning"},
+	}
+	if got := m.SelfTransitions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SelfTransitions() = %v, want %v", got, want)
+	}
+}
+
+func TestReverseAmbiguities(t *testing.T) {
+	m := NewMachine("draft", Events{
+		{Name: "submit", Src: []string{"draft"}, Dst: "review"},
+		{Name: "close", Src: []string{"draft", "review"}, Dst: "closed"},
+		{Name: "reopen", Src: []string{"closed"}, Dst: "draft"},
+	}, nil)
+	want := []Transition{
+		{Event: "close", Src: "draft", Dst: "closed"},
+		{Event: "close", Src: "review", Dst: "closed"},
+	}
+	if got := m.ReverseAmbiguities(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReverseAmbiguities() = %v, want %v", got, want)
+	}
+
+	if got := NewMachine("idle", exampleEvents(), nil).ReverseAmbiguities(); got != nil {
+		t.Fatalf("ReverseAmbiguities() on the example machine = %v, want nil", got)
+	}
+}
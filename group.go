@@ -0,0 +1,64 @@
+package fsm
+
+import "sync"
+
+// MachineGroup 按名字管理一组 Machine, 用于批量操作
+type MachineGroup struct {
+	mu       sync.RWMutex
+	machines map[string]*Machine
+}
+
+func NewMachineGroup() *MachineGroup {
+	return &MachineGroup{machines: make(map[string]*Machine)}
+}
+
+/**
+Add: 以 name 加入一个 Machine, 同名的 Machine 会被替换
+*/
+func (g *MachineGroup) Add(name string, m *Machine) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.machines[name] = m
+}
+
+/**
+Get: 返回名为 name 的 Machine
+*/
+func (g *MachineGroup) Get(name string) (*Machine, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	m, ok := g.machines[name]
+	return m, ok
+}
+
+/**
+CompletePending: 对所有有异步迁移进行中的成员调用 Transition
+返回失败成员的名字到错误的映射
+*/
+func (g *MachineGroup) CompletePending() map[string]error {
+	return g.eachPending((*Machine).Transition)
+}
+
+/**
+AbortPending: 对所有有异步迁移进行中的成员调用 CancelTransition
+返回失败成员的名字到错误的映射
+*/
+func (g *MachineGroup) AbortPending() map[string]error {
+	return g.eachPending((*Machine).CancelTransition)
+}
+
+// eachPending 对所有有异步迁移进行中的成员执行 fn, 收集返回的错误
+func (g *MachineGroup) eachPending(fn func(m *Machine) error) map[string]error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	errs := make(map[string]error)
+	for name, m := range g.machines {
+		if !m.IsTransitioning() {
+			continue
+		}
+		if err := fn(m); err != nil {
+			errs[name] = err
+		}
+	}
+	return errs
+}
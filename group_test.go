@@ -0,0 +1,50 @@
+package fsm
+
+import "testing"
+
+// newAsyncGroup 返回包含三个成员的组: pending1 和 pending2 的 scan 迁移进行中, idle 没有进行中的迁移
+func newAsyncGroup(t *testing.T) *MachineGroup {
+	t.Helper()
+	g := NewMachineGroup()
+	for _, name := range []string{"pending1", "pending2", "idle"} {
+		m := NewMachine("idle", exampleEvents(), Callbacks{
+			"leave_idle": func(e *Event) { e.Async() },
+		})
+		if name != "idle" {
+			if _, ok := m.Event("scan").(AsyncError); !ok {
+				t.Fatalf("%s: Event(scan) should start an async transition", name)
+			}
+		}
+		g.Add(name, m)
+	}
+	return g
+}
+
+func TestGroupCompletePending(t *testing.T) {
+	g := newAsyncGroup(t)
+
+	if errs := g.CompletePending(); len(errs) != 0 {
+		t.Fatalf("CompletePending() = %v, want no errors", errs)
+	}
+	want := map[string]string{"pending1": "scanning", "pending2": "scanning", "idle": "idle"}
+	for name, state := range want {
+		m, _ := g.Get(name)
+		if m.Current() != state || m.IsTransitioning() {
+			t.Fatalf("%s: state %q, transitioning %v; want %q, false", name, m.Current(), m.IsTransitioning(), state)
+		}
+	}
+}
+
+func TestGroupAbortPending(t *testing.T) {
+	g := newAsyncGroup(t)
+
+	if errs := g.AbortPending(); len(errs) != 0 {
+		t.Fatalf("AbortPending() = %v, want no errors", errs)
+	}
+	for _, name := range []string{"pending1", "pending2", "idle"} {
+		m, _ := g.Get(name)
+		if m.Current() != "idle" || m.IsTransitioning() {
+			t.Fatalf("%s: state %q, transitioning %v; want idle, false", name, m.Current(), m.IsTransitioning())
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package fsm
+
+import "strconv"
+
+// GuardFunc 在执行事件前判断迁移是否允许, 返回 false 时拒绝迁移
+// 守卫会被 CanWithArgs 调用, 因此必须没有副作用
+type GuardFunc func(e *Event) bool
+
+/**
+AddGuard: 为事件 event 添加守卫, 多个守卫按添加顺序执行, 全部通过才允许迁移
+守卫拒绝时 Event 返回 TransitionDeniedError, 不会执行任何回调
+*/
+func (m *Machine) AddGuard(event string, guard GuardFunc) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.guards == nil {
+		m.guards = make(map[string][]GuardFunc)
+	}
+	m.guards[event] = append(m.guards[event], guard)
+}
+
+/**
+CanWithArgs: 与 Can 相同, 但额外使用 args 执行事件的守卫
+不会执行任何回调, 也不会改变状态
+*/
+func (m *Machine) CanWithArgs(event string, args ...interface{}) bool {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	dst, ok := m.transitions[eKey{event, m.current}]
+	if !ok || m.disabled[event] || (m.transition != nil && !m.noTransitionGuard) {
+		return false
+	}
+	e := &Event{Machine: m, Event: event, Src: m.current, Dst: dst, Args: args}
+	return m.checkGuards(e)
+}
+
+/**
+RegisterGuard: 注册名为 name 的守卫, 供 EventDesc.Guards 引用
+守卫拒绝时 TransitionDeniedError.Guard 为 name; 引用了但没有注册的守卫名总是拒绝迁移
+*/
+func (m *Machine) RegisterGuard(name string, guard GuardFunc) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.guardFuncs == nil {
+		m.guardFuncs = make(map[string]GuardFunc)
+	}
+	m.guardFuncs[name] = guard
+}
+
+// addNamedGuard 把守卫名 name 加到事件 event 的守卫列表末尾, 已存在时忽略
+func (m *Machine) addNamedGuard(event, name string) {
+	for _, existing := range m.namedGuards[event] {
+		if existing == name {
+			return
+		}
+	}
+	if m.namedGuards == nil {
+		m.namedGuards = make(map[string][]string)
+	}
+	m.namedGuards[event] = append(m.namedGuards[event], name)
+}
+
+// checkGuards 依次执行 e.Event 的具名守卫和 AddGuard 添加的守卫, 遇到第一个拒绝的守卫即停止,
+// 调用方需持有 stateMu
+func (m *Machine) checkGuards(e *Event) bool {
+	for _, name := range m.namedGuards[e.Event] {
+		e.deniedBy = ""
+		guard, ok := m.guardFuncs[name]
+		if !ok || !guard(e) {
+			e.deniedBy = joinGuardPath(name, e.deniedBy)
+			return false
+		}
+	}
+	for _, guard := range m.guards[e.Event] {
+		e.deniedBy = ""
+		if !guard(e) {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+AllGuards: 组合多个守卫, 全部通过才允许迁移, 遇到第一个拒绝的守卫即停止
+拒绝时 TransitionDeniedError.Guard 为 "AllGuards[i]", i 为拒绝的守卫下标
+*/
+func AllGuards(gs ...GuardFunc) GuardFunc {
+	return func(e *Event) bool {
+		for i, g := range gs {
+			e.deniedBy = ""
+			if !g(e) {
+				e.deniedBy = joinGuardPath("AllGuards["+strconv.Itoa(i)+"]", e.deniedBy)
+				return false
+			}
+		}
+		return true
+	}
+}
+
+/**
+AnyGuard: 组合多个守卫, 任意一个通过即允许迁移
+全部拒绝时 TransitionDeniedError.Guard 为 "AnyGuard"
+*/
+func AnyGuard(gs ...GuardFunc) GuardFunc {
+	return func(e *Event) bool {
+		for _, g := range gs {
+			if g(e) {
+				e.deniedBy = ""
+				return true
+			}
+		}
+		e.deniedBy = "AnyGuard"
+		return false
+	}
+}
+
+// joinGuardPath 把内层守卫的名字拼接到外层守卫后面
+func joinGuardPath(outer, inner string) string {
+	if inner == "" {
+		return outer
+	}
+	return outer + "." + inner
+}
@@ -0,0 +1,180 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamedGuardsFirstDenyWins(t *testing.T) {
+	var ran []string
+	guard := func(name string, allow bool) GuardFunc {
+		return func(e *Event) bool {
+			ran = append(ran, name)
+			return allow
+		}
+	}
+	m := NewMachine("idle", Events{
+		{Name: "scan", Src: []string{"idle"}, Dst: "scanning", Guards: []string{"first", "second", "third"}},
+	}, nil)
+	m.RegisterGuard("first", guard("first", true))
+	m.RegisterGuard("second", guard("second", false))
+	m.RegisterGuard("third", guard("third", true))
+
+	err := m.Event("scan")
+	denied, ok := err.(TransitionDeniedError)
+	if !ok || denied.Guard != "second" {
+		t.Fatalf("Event(scan) = %v, want TransitionDeniedError from guard second", err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(ran, want) {
+		t.Fatalf("guards ran %v, want %v", ran, want)
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q, want idle", m.Current())
+	}
+}
+
+func TestUnregisteredNamedGuardDenies(t *testing.T) {
+	m := NewMachine("idle", Events{
+		{Name: "scan", Src: []string{"idle"}, Dst: "scanning", Guards: []string{"missing"}},
+	}, nil)
+	if denied, ok := m.Event("scan").(TransitionDeniedError); !ok || denied.Guard != "missing" {
+		t.Fatalf("Event(scan) = %v, want TransitionDeniedError from guard missing", denied)
+	}
+}
+
+func TestCanWithArgsRunsGuards(t *testing.T) {
+	var entered int
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_scanning": func(e *Event) { entered++ },
+	})
+	m.AddGuard("scan", func(e *Event) bool {
+		return len(e.Args) == 1 && e.Args[0] == "authorized"
+	})
+
+	if m.CanWithArgs("scan", "anonymous") {
+		t.Fatalf("CanWithArgs(scan, anonymous) = true, guard should reject")
+	}
+	if !m.CanWithArgs("scan", "authorized") {
+		t.Fatalf("CanWithArgs(scan, authorized) = false, guard should accept")
+	}
+	if m.CanWithArgs("finish", "authorized") {
+		t.Fatalf("CanWithArgs(finish) = true for an event invalid in idle")
+	}
+	if m.Current() != "idle" || entered != 0 {
+		t.Fatalf("CanWithArgs changed state to %q or ran callbacks %d times", m.Current(), entered)
+	}
+
+	if _, ok := m.Event("scan", "anonymous").(TransitionDeniedError); !ok {
+		t.Fatalf("Event(scan, anonymous) should return TransitionDeniedError")
+	}
+	if err := m.Event("scan", "authorized"); err != nil || m.Current() != "scanning" {
+		t.Fatalf("Event(scan, authorized) = %v, state %q", err, m.Current())
+	}
+}
+
+func TestOnDeniedFiresForDeniedEventOnly(t *testing.T) {
+	var denied []string
+	record := func(e *Event) { denied = append(denied, e.Event+"@"+e.Src) }
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"on_denied_scan":      record,
+		"on_denied_situation": record,
+	})
+	m.AddGuard("scan", func(e *Event) bool { return len(e.Args) > 0 })
+
+	m.Event("situation")
+	m.Event("scan")
+	m.Event("scan", "token")
+	if want := []string{"scan@idle"}; !reflect.DeepEqual(denied, want) {
+		t.Fatalf("on_denied_ callbacks saw %v, want %v", denied, want)
+	}
+}
+
+// hasArg 返回一个在参数中包含 want 时通过的守卫
+func hasArg(want string) GuardFunc {
+	return func(e *Event) bool {
+		for _, arg := range e.Args {
+			if arg == want {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestGuardCombinators(t *testing.T) {
+	// admin && (token || internal)
+	policy := AllGuards(hasArg("admin"), AnyGuard(hasArg("token"), hasArg("internal")))
+
+	tests := []struct {
+		args  []interface{}
+		guard string
+	}{
+		{[]interface{}{"admin", "token"}, ""},
+		{[]interface{}{"admin", "internal"}, ""},
+		{[]interface{}{"token"}, "AllGuards[0]"},
+		{[]interface{}{"admin"}, "AllGuards[1].AnyGuard"},
+	}
+	for _, tt := range tests {
+		m := NewMachine("idle", exampleEvents(), nil)
+		m.AddGuard("scan", policy)
+
+		err := m.Event("scan", tt.args...)
+		if tt.guard == "" {
+			if err != nil {
+				t.Fatalf("Event(scan, %v) = %v, want allowed", tt.args, err)
+			}
+			continue
+		}
+		denied, ok := err.(TransitionDeniedError)
+		if !ok || denied.Guard != tt.guard {
+			t.Fatalf("Event(scan, %v) = %v, want denial by %s", tt.args, err, tt.guard)
+		}
+	}
+}
+
+// decisionEvents 是 pending 状态下的 approve/reject 二选一
+func decisionEvents() Events {
+	return Events{
+		{Name: "approve", Src: []string{"pending"}, Dst: "approved"},
+		{Name: "reject", Src: []string{"pending"}, Dst: "rejected"},
+	}
+}
+
+func TestFireOrElsePrimary(t *testing.T) {
+	m := NewMachine("pending", decisionEvents(), nil)
+	m.AddGuard("approve", hasArg("signed"))
+
+	fired, err := m.FireOrElse("approve", "reject", "signed")
+	if fired != "approve" || err != nil {
+		t.Fatalf("FireOrElse() = %q, %v; want approve, nil", fired, err)
+	}
+	if m.Current() != "approved" {
+		t.Fatalf("Current() = %q, want approved", m.Current())
+	}
+}
+
+func TestFireOrElseFallback(t *testing.T) {
+	m := NewMachine("pending", decisionEvents(), nil)
+	m.AddGuard("approve", hasArg("signed"))
+
+	fired, err := m.FireOrElse("approve", "reject")
+	if fired != "reject" || err != nil {
+		t.Fatalf("FireOrElse() = %q, %v; want reject, nil", fired, err)
+	}
+	if m.Current() != "rejected" {
+		t.Fatalf("Current() = %q, want rejected", m.Current())
+	}
+}
+
+func TestFireOrElseOtherErrorSkipsFallback(t *testing.T) {
+	m := NewMachine("approved", decisionEvents(), nil)
+	m.AddTransition("reject", "approved", "rejected")
+
+	fired, err := m.FireOrElse("approve", "reject")
+	if _, ok := err.(InvalidEventError); !ok || fired != "approve" {
+		t.Fatalf("FireOrElse() = %q, %v; want approve, InvalidEventError", fired, err)
+	}
+	if m.Current() != "approved" {
+		t.Fatalf("Current() = %q, want approved", m.Current())
+	}
+}
@@ -0,0 +1,57 @@
+package fsm
+
+// Handler 在一个对象中实现四个全局回调
+// BeforeEvent 和 LeaveState 返回错误时取消迁移, 相当于调用 e.Cancel(err)
+type Handler interface {
+	BeforeEvent(e *Event) error
+	LeaveState(e *Event) error
+	EnterState(e *Event)
+	AfterEvent(e *Event)
+}
+
+// BaseHandler 是什么都不做的 Handler, 可以嵌入到只关心部分阶段的实现中
+type BaseHandler struct{}
+
+func (BaseHandler) BeforeEvent(e *Event) error { return nil }
+func (BaseHandler) LeaveState(e *Event) error  { return nil }
+func (BaseHandler) EnterState(e *Event)        {}
+func (BaseHandler) AfterEvent(e *Event)        {}
+
+/**
+RegisterHandler: 把 h 注册为 before_event/leave_state/enter_state/after_event 全局回调
+已有的全局回调会保留, 并在 h 之前执行
+*/
+func (m *Machine) RegisterHandler(h Handler) {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+
+	m.chainGlobal(callbackBeforeEvent, func(e *Event) {
+		if err := h.BeforeEvent(e); err != nil {
+			e.Cancel(err)
+		}
+	})
+	m.chainGlobal(callbackLeaveState, func(e *Event) {
+		if err := h.LeaveState(e); err != nil {
+			e.Cancel(err)
+		}
+	})
+	m.chainGlobal(callbackEnterState, h.EnterState)
+	m.chainGlobal(callbackAfterEvent, h.AfterEvent)
+}
+
+// chainGlobal 在 callbackType 类型的全局回调之后追加 fn, 前一个回调取消迁移时不再执行 fn
+func (m *Machine) chainGlobal(callbackType int, fn Callback) {
+	key := cKey{"", callbackType}
+	prev, ok := m.callbacks[key]
+	if !ok {
+		m.callbacks[key] = fn
+		return
+	}
+	m.callbacks[key] = func(e *Event) {
+		prev(e)
+		if e.canceled {
+			return
+		}
+		fn(e)
+	}
+}
@@ -0,0 +1,72 @@
+package fsm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingHandler 记录每个阶段的调用, before 不为 nil 时从 BeforeEvent 返回它
+type recordingHandler struct {
+	BaseHandler
+	phases []string
+	before error
+}
+
+func (h *recordingHandler) BeforeEvent(e *Event) error {
+	h.phases = append(h.phases, "before "+e.Event)
+	return h.before
+}
+
+func (h *recordingHandler) LeaveState(e *Event) error {
+	h.phases = append(h.phases, "leave "+e.Src)
+	return nil
+}
+
+func (h *recordingHandler) EnterState(e *Event) {
+	h.phases = append(h.phases, "enter "+e.Dst)
+}
+
+func (h *recordingHandler) AfterEvent(e *Event) {
+	h.phases = append(h.phases, "after "+e.Event)
+}
+
+func TestRegisterHandlerPhases(t *testing.T) {
+	h := &recordingHandler{}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_state": func(e *Event) { h.phases = append(h.phases, "callback enter") },
+	})
+	m.RegisterHandler(h)
+
+	if err := m.Event("scan"); err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+	// 已有的全局回调在 Handler 之前执行
+	want := []string{"before scan", "leave idle", "callback enter", "enter scanning", "after scan"}
+	if !reflect.DeepEqual(h.phases, want) {
+		t.Fatalf("phases = %v, want %v", h.phases, want)
+	}
+}
+
+func TestRegisterHandlerBeforeEventAborts(t *testing.T) {
+	errClosed := errors.New("closed")
+	h := &recordingHandler{before: errClosed}
+	m := NewMachine("idle", exampleEvents(), nil)
+	m.RegisterHandler(h)
+
+	err := m.Event("scan")
+	if canceled, ok := err.(CanceledError); !ok || canceled.Err != errClosed {
+		t.Fatalf("Event(scan) = %v, want CanceledError wrapping errClosed", err)
+	}
+	if want := []string{"before scan"}; !reflect.DeepEqual(h.phases, want) || m.Current() != "idle" {
+		t.Fatalf("phases = %v in %q, want %v in idle", h.phases, m.Current(), want)
+	}
+}
+
+func TestBaseHandlerIsNoop(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	m.RegisterHandler(BaseHandler{})
+	if err := m.Event("scan"); err != nil || m.Current() != "scanning" {
+		t.Fatalf("Event(scan) with BaseHandler = %v in %q", err, m.Current())
+	}
+}
@@ -0,0 +1,31 @@
+package fsm
+
+import "sync"
+
+// internTable 保存所有 Machine 共享的状态名和事件名
+// 用同一份定义构造大量 Machine 时, 相同的名字只保留一份底层存储
+var internTable sync.Map
+
+// internDisabled 为 true 时 intern 直接返回参数, 仅用于在测试中对比内存占用
+var internDisabled bool
+
+// intern 返回与 s 相等的共享字符串, 只在 NewMachine 中对定义里的名字调用, 表的大小受定义限制
+func intern(s string) string {
+	if internDisabled {
+		return s
+	}
+	if v, ok := internTable.Load(s); ok {
+		return v.(string)
+	}
+	v, _ := internTable.LoadOrStore(s, s)
+	return v.(string)
+}
+
+// interned 返回表中已有的与 s 相等的字符串, 没有时返回 s 本身, 不会向表中加入新的名字
+// 用于 AddTransition 等运行时传入任意字符串的地方, 避免表无限增长
+func interned(s string) string {
+	if v, ok := internTable.Load(s); ok {
+		return v.(string)
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package fsm
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+// dynamicEvents 返回名字在运行时构造的 exampleEvents, 每次调用的字符串都有独立的底层存储
+func dynamicEvents() Events {
+	events := exampleEvents()
+	for i := range events {
+		events[i].Name = string([]byte(events[i].Name))
+		events[i].Dst = string([]byte(events[i].Dst))
+		src := make([]string, len(events[i].Src))
+		for j, s := range events[i].Src {
+			src[j] = string([]byte(s))
+		}
+		events[i].Src = src
+	}
+	return events
+}
+
+// stringData 返回字符串底层存储的地址
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestInternSharesNamesAcrossMachines(t *testing.T) {
+	a := NewMachine(string([]byte("idle")), dynamicEvents(), nil)
+	b := NewMachine(string([]byte("idle")), dynamicEvents(), nil)
+
+	if stringData(a.Current()) != stringData(b.Current()) {
+		t.Fatalf("initial states of two machines do not share storage")
+	}
+	a.Event("scan")
+	b.Event("scan")
+	if stringData(a.Current()) != stringData(b.Current()) {
+		t.Fatalf("destination states of two machines do not share storage")
+	}
+}
+
+// retainedPerMachine 构造 n 个 Machine, 每个都使用独立构造的定义(如各自从存储中解码),
+// 返回 GC 之后每个 Machine 平均占用的堆内存
+func retainedPerMachine(n int) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	machines := make([]*Machine, n)
+	for i := range machines {
+		machines[i] = NewMachine(string([]byte("idle")), dynamicEvents(), nil)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(machines)
+	return (after.HeapAlloc - before.HeapAlloc) / uint64(n)
+}
+
+func TestInternReducesRetainedHeap(t *testing.T) {
+	interned := retainedPerMachine(2000)
+	internDisabled = true
+	defer func() { internDisabled = false }()
+	plain := retainedPerMachine(2000)
+
+	t.Logf("retained per machine: %d bytes interned, %d bytes without interning", interned, plain)
+	if interned >= plain {
+		t.Fatalf("interning retains %d bytes per machine, want less than %d without interning", interned, plain)
+	}
+}
+
+func TestAddTransitionDoesNotGrowInternTable(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	event, dst := string([]byte("runtime-only-event")), string([]byte("runtime-only-state"))
+	m.AddTransition(event, "idle", dst)
+
+	for _, name := range []string{event, dst} {
+		if _, ok := internTable.Load(name); ok {
+			t.Fatalf("AddTransition interned %q", name)
+		}
+	}
+	m.Event(event)
+	if m.Current() != dst {
+		t.Fatalf("Current() = %q, want %q", m.Current(), dst)
+	}
+}
+
+// BenchmarkNewMachine 对比开启和关闭 interning 时构造 Machine 的开销和每个 Machine 保留的堆内存
+func BenchmarkNewMachine(b *testing.B) {
+	for _, bb := range []struct {
+		name     string
+		disabled bool
+	}{
+		{"interned", false},
+		{"plain", true},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			internDisabled = bb.disabled
+			defer func() { internDisabled = false }()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				NewMachine("idle", dynamicEvents(), nil)
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(retainedPerMachine(1000)), "retained-B/machine")
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package fsm
+
+import "sync"
+
+// stateLimits 保存所有 Machine 共享的 enter_<state> 回调并发限制
+var (
+	stateLimitsMu sync.Mutex
+	stateLimits   = make(map[string]chan struct{})
+)
+
+/**
+SetStateConcurrencyLimit: 限制所有 Machine 中同时执行的 enter_<state> 回调不超过 n 个, n <= 0 时取消限制
+超出限制的回调会阻塞等待; 事件的 ctx 在等待期间被取消时跳过该回调, 并把 ctx.Err() 设置到 e.Err
+*/
+func SetStateConcurrencyLimit(state string, n int) {
+	stateLimitsMu.Lock()
+	defer stateLimitsMu.Unlock()
+	if n <= 0 {
+		delete(stateLimits, state)
+		return
+	}
+	stateLimits[state] = make(chan struct{}, n)
+}
+
+// acquireStateSlot 获取状态 state 的并发名额, 返回释放名额的函数; ctx 被取消时返回 false
+func acquireStateSlot(e *Event, state string) (release func(), ok bool) {
+	stateLimitsMu.Lock()
+	sem, limited := stateLimits[state]
+	stateLimitsMu.Unlock()
+	if !limited {
+		return func() {}, true
+	}
+
+	if e.Ctx == nil {
+		sem <- struct{}{}
+		return func() { <-sem }, true
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, true
+	case <-e.Ctx.Done():
+		e.Err = e.Ctx.Err()
+		return nil, false
+	}
+}
@@ -0,0 +1,81 @@
+package fsm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStateConcurrencyLimit(t *testing.T) {
+	SetStateConcurrencyLimit("pooled", 2)
+	defer SetStateConcurrencyLimit("pooled", 0)
+
+	var mu sync.Mutex
+	var active, peak, entered int
+	events := Events{{Name: "connect", Src: []string{"idle"}, Dst: "pooled"}}
+	callbacks := Callbacks{
+		"enter_pooled": func(e *Event) {
+			mu.Lock()
+			active++
+			entered++
+			if active > peak {
+				peak = active
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		m := NewMachine("idle", events, callbacks)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Event("connect"); err != nil {
+				t.Errorf("Event(connect) = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if entered != 8 || peak > 2 {
+		t.Fatalf("enter_pooled ran %d times with peak concurrency %d, want 8 with at most 2", entered, peak)
+	}
+}
+
+func TestStateConcurrencyLimitHonorsContext(t *testing.T) {
+	SetStateConcurrencyLimit("pooled", 1)
+	defer SetStateConcurrencyLimit("pooled", 0)
+
+	events := Events{{Name: "connect", Src: []string{"idle"}, Dst: "pooled"}}
+	release := make(chan struct{})
+	holding := make(chan struct{})
+	holder := NewMachine("idle", events, Callbacks{
+		"enter_pooled": func(e *Event) {
+			close(holding)
+			<-release
+		},
+	})
+	done := make(chan error)
+	go func() { done <- holder.Event("connect") }()
+	<-holding
+
+	var ran bool
+	waiter := NewMachine("idle", events, Callbacks{
+		"enter_pooled": func(e *Event) { ran = true },
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := waiter.EventContext(ctx, "connect")
+	close(release)
+	<-done
+
+	if err != context.DeadlineExceeded || ran {
+		t.Fatalf("EventContext while the slot is held = %v (callback ran %v), want DeadlineExceeded", err, ran)
+	}
+}
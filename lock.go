@@ -0,0 +1,38 @@
+package fsm
+
+import "sync"
+
+// stateLock 是 stateMu 的类型, 默认与 sync.RWMutex 相同, 启用 WithWriterPriority 后增加一个闸门
+type stateLock struct {
+	sync.RWMutex
+	writerPriority bool
+	turnstile      sync.Mutex
+}
+
+/**
+WithWriterPriority: 让提交状态的写操作与 Current 等读操作按到达顺序通过一个闸门, 写操作不会被持续到达的读操作饿死
+等待中的写操作持有闸门, 之后到达的读操作在闸门处排队, 直到写操作完成; sync.RWMutex 本身已经会在有写者等待时阻塞新的读者,
+闸门在此之上让多个写者与读者之间也按顺序排队(sync.Mutex 等待过久后转为先进先出).
+代价是每次读操作都要额外获取一次互斥锁, 在读多写少且没有竞争时会更慢, 只在确实观察到写操作延迟时使用
+*/
+func WithWriterPriority() Option {
+	return func(m *Machine) {
+		m.stateMu.writerPriority = true
+	}
+}
+
+func (l *stateLock) RLock() {
+	if l.writerPriority {
+		l.turnstile.Lock()
+		l.turnstile.Unlock()
+	}
+	l.RWMutex.RLock()
+}
+
+func (l *stateLock) Lock() {
+	if l.writerPriority {
+		l.turnstile.Lock()
+		defer l.turnstile.Unlock()
+	}
+	l.RWMutex.Lock()
+}
@@ -0,0 +1,77 @@
+package fsm
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// maxCommitDelay 在 readers 个并发读者的压力下执行 rounds 轮 scan/finish, 返回单轮迁移的最长耗时
+// 读者每读一次把时钟推进 1ms, 因此耗时反映了迁移等待期间完成的读操作次数
+func maxCommitDelay(t *testing.T, readers, rounds int, opts ...Option) time.Duration {
+	clock := newFakeClock()
+	m := NewMachine("idle", exampleEvents(), nil, append(opts, WithClock(clock))...)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// 读取提交迁移时写入的字段
+				m.Current()
+				m.Stats()
+				m.PendingState()
+				clock.Advance(time.Millisecond)
+			}
+		}()
+	}
+
+	var max time.Duration
+	for i := 0; i < rounds; i++ {
+		start := clock.Now()
+		if err := m.Event("scan"); err != nil {
+			t.Fatalf("Event(scan) = %v", err)
+		}
+		if err := m.Event("finish"); err != nil {
+			t.Fatalf("Event(finish) = %v", err)
+		}
+		if d := clock.Now().Sub(start); d > max {
+			max = d
+		}
+		// 让读者在两轮之间也能运行, 单核机器上否则写者会一直占用处理器
+		runtime.Gosched()
+	}
+	close(stop)
+	wg.Wait()
+	return max
+}
+
+func TestWriterPriorityUnderReadLoad(t *testing.T) {
+	const readers = 16
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	max := maxCommitDelay(t, readers, 200, WithWriterPriority())
+	t.Logf("longest scan/finish round: %v of reader time", max)
+	// 被饿死的写者会等待任意多次读操作; 读者在写者被调度出去的时间片里仍会继续读取,
+	// 因此上限按每个读者数千次读取留出调度的余量, 只用来发现写者无法前进的情况
+	if bound := readers * 4 * time.Second; max > bound {
+		t.Fatalf("a scan/finish round waited %v of reader time, want at most %v", max, bound)
+	}
+}
+
+func TestCloneKeepsWriterPriority(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil, WithWriterPriority())
+	if c := m.Clone(); !c.stateMu.writerPriority {
+		t.Fatal("Clone dropped WithWriterPriority")
+	}
+	if c := NewMachine("idle", exampleEvents(), nil).Clone(); c.stateMu.writerPriority {
+		t.Fatal("Clone enabled writer priority without WithWriterPriority")
+	}
+}
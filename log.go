@@ -0,0 +1,53 @@
+package fsm
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// transitionLog 是 WithJSONLogger 输出的一行日志
+type transitionLog struct {
+	Timestamp  string  `json:"timestamp"`
+	Machine    string  `json:"machine,omitempty"`
+	ID         string  `json:"id,omitempty"`
+	Event      string  `json:"event"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Outcome    string  `json:"outcome"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+/**
+WithJSONLogger: 每次执行事件后向 w 写入一行 JSON 日志
+字段为 timestamp, machine, id, event, from, to, outcome, error, duration_ms, 时间来自 Machine 的时钟;
+machine 为 SetName 设置的名字, 为空时省略; id 为 Event.ID, 事件没有执行到回调阶段(如未知事件)时省略
+*/
+func WithJSONLogger(w io.Writer) Option {
+	return func(m *Machine) {
+		m.jsonLog = json.NewEncoder(w)
+	}
+}
+
+// logTransition 记录一次事件执行的结果, 未设置日志时不做任何事
+func (m *Machine) logTransition(id, event, from string, start time.Time, err error) {
+	if m.jsonLog == nil {
+		return
+	}
+	now := m.clock.Now()
+	record := transitionLog{
+		Timestamp:  now.UTC().Format(time.RFC3339Nano),
+		Machine:    m.Name(),
+		ID:         id,
+		Event:      event,
+		From:       from,
+		To:         m.Current(),
+		Outcome:    outcomeOf(err).String(),
+		DurationMs: float64(now.Sub(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	m.jsonLog.Encode(record)
+}
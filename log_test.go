@@ -0,0 +1,76 @@
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeLogs 把 WithJSONLogger 的输出解析为每行一个 transitionLog
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []transitionLog {
+	t.Helper()
+	var logs []transitionLog
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record transitionLog
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		logs = append(logs, record)
+	}
+	return logs
+}
+
+func TestJSONLoggerRecordsTransitions(t *testing.T) {
+	var buf bytes.Buffer
+	clock := newFakeClock()
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_scanning": func(e *Event) { clock.Advance(1500 * time.Microsecond) },
+	}, WithClock(clock), WithJSONLogger(&buf))
+
+	m.Event("scan")
+	m.Event("scan")
+
+	logs := decodeLogs(t, &buf)
+	if len(logs) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(logs), buf.String())
+	}
+
+	ok := logs[0]
+	if ok.Event != "scan" || ok.From != "idle" || ok.To != "scanning" || ok.Outcome != "committed" || ok.Error != "" {
+		t.Fatalf("successful transition logged as %+v", ok)
+	}
+	if ok.DurationMs != 1.5 {
+		t.Fatalf("duration_ms = %v, want 1.5", ok.DurationMs)
+	}
+	if want := "2020-01-01T00:00:00.0015Z"; ok.Timestamp != want {
+		t.Fatalf("timestamp = %q, want %q", ok.Timestamp, want)
+	}
+
+	failed := logs[1]
+	if failed.From != "scanning" || failed.To != "scanning" || failed.Outcome != "invalid" ||
+		!strings.Contains(failed.Error, "inappropriate in current state scanning") {
+		t.Fatalf("failed transition logged as %+v", failed)
+	}
+}
+
+func TestJSONLoggerIncludesMachineName(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMachine("idle", exampleEvents(), nil, WithClock(newFakeClock()), WithJSONLogger(&buf))
+	if m.Name() != "" {
+		t.Fatalf("default Name() = %q, want empty", m.Name())
+	}
+
+	m.Event("scan")
+	m.SetName("scanner-1")
+	m.Event("finish")
+
+	logs := decodeLogs(t, &buf)
+	if len(logs) != 2 || logs[0].Machine != "" || logs[1].Machine != "scanner-1" {
+		t.Fatalf("logged machine names %+v, want \"\" then scanner-1", logs)
+	}
+	if strings.Contains(strings.SplitN(buf.String(), "\n", 2)[0], `"machine"`) {
+		t.Fatalf("empty machine name not omitted: %s", buf.String())
+	}
+}
@@ -1,80 +1,264 @@
 package fsm
 
 import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Machine struct {
-	current         string
-	transitions     map[eKey]string
-	callbacks       map[cKey]Callback
-	transition      func()
-	transitionerObj transitioner
-	stateMu         sync.RWMutex
-	eventMu         sync.Mutex
+	name                  string
+	initial               string
+	current               string
+	lastEvent             string
+	enteredAt             time.Time
+	stats                 map[string]StateStat
+	started               bool
+	initEvent             string
+	transitions           map[eKey]string
+	transitionMeta        map[eKey]map[string]interface{}
+	reachable             map[string]bool
+	stateTags             map[string]map[string]bool
+	finalStates           map[string]bool
+	errorStates           map[string]string
+	transient             map[string]int
+	argCounts             map[string]int
+	argsTransformer       func(event string, args []interface{}) []interface{}
+	guards                map[string][]GuardFunc
+	guardFuncs            map[string]GuardFunc
+	namedGuards           map[string][]string
+	disabled              map[string]bool
+	rolePolicy            map[string]map[string]bool
+	macros                map[string][]string
+	subMachines           map[string]*Machine
+	callbacks             map[cKey]Callback
+	enterExcept           []exceptCallback
+	entered               map[string]bool
+	onceMu                sync.Mutex
+	onTransition          []func(from, to, event string, args []interface{})
+	onError               []func(e *Event)
+	onFinal               []func(e *Event)
+	middleware            []Middleware
+	ambiguousCallbacks    []string
+	transition            func()
+	pendingDst            string
+	transitionerObj       transitioner
+	asyncTimeout          time.Duration
+	asyncSeq              uint64
+	eventSeq              uint64
+	stateMu               stateLock
+	eventMu               sync.Mutex
+	eventOwner            int64
+	inFlightMu            sync.Mutex
+	inFlight              map[string]bool
+	callbackOwner         int64
+	noReentrancyCheck     bool
+	strictReentrancy      bool
+	raceCheck             bool
+	noTransitionGuard     bool
+	noTransitionAsSuccess bool
+	clock                 Clock
+	scheduleMu            sync.Mutex
+	scheduled             map[uint64]Timer
+	scheduleSeq           uint64
+	metrics               MetricsCollector
+	lockMetrics           MetricsCollector
+	jsonLog               *json.Encoder
+	rateLimit             *rateLimiter
+	queue                 eventQueue
 }
 
+// EventDesc 描述一个事件, Dst 为 "=" 或 "*" 时表示停留在当前状态(自迁移)
+//
+// Transient 为 true 的事件在进入其任一 Src 状态后自动执行;
+// 同一状态有多个可自动执行的事件时选择 Priority 最大的一个, 相同时按事件名排序取第一个.
+// Priority 只影响自动执行时的选择, 不影响显式调用 Event
+//
+// ArgCount 大于 0 时, Event 会在执行回调前检查参数个数, 不一致时返回 ArgMismatchError;
+// Guards 是通过 RegisterGuard 注册的守卫名, 按声明顺序在 AddGuard 添加的守卫之前执行
 type EventDesc struct {
-	Name string
-	Src  []string
-	Dst  string
+	Name      string
+	Src       []string
+	Dst       string
+	Meta      map[string]interface{}
+	Transient bool
+	Priority  int
+	ArgCount  int
+	Guards    []string
 }
 
+// isSelfDst 判断 Dst 是否为表示"停留在当前状态"的占位符
+func isSelfDst(dst string) bool {
+	return dst == "=" || dst == "*"
+}
+
+// emptyArgs 在没有参数时被所有 Event 共享, 避免热路径上的分配
+var emptyArgs = []interface{}{}
+
 type Callback func(event *Event)
 type Events []EventDesc
+
+// Callbacks 是回调名到回调函数的映射
+// 每个阶段的回调都按固定顺序执行: 先执行针对具体状态/事件的回调, 再执行全局回调;
+// 任一回调取消迁移后, 同一阶段后面的回调不再执行
 type Callbacks map[string]Callback
 
-func NewMachine(initialState string, events []EventDesc, callbacks Callbacks) *Machine {
+func NewMachine(initialState string, events []EventDesc, callbacks Callbacks, opts ...Option) *Machine {
+	m, _ := newMachine(initialState, events, callbacks, opts)
+	return m
+}
+
+/**
+NewMachineChecked: 与 NewMachine 相同, 但会检查定义中的错误:
+回调名既不是已知的状态/事件, 也不是全局回调时返回 UnknownCallbackTargetError, 用于发现拼写错误;
+WithErrorState 的补偿事件不能在错误状态下执行时返回 InvalidEventError;
+自动事件(Transient)构成环(包括自环)时返回 TransientLoopError, 否则运行时会无限迁移或每次都失败
+*/
+func NewMachineChecked(initialState string, events []EventDesc, callbacks Callbacks, opts ...Option) (*Machine, error) {
+	m, unknown := newMachine(initialState, events, callbacks, opts)
+	if len(unknown) > 0 {
+		return nil, UnknownCallbackTargetError{Name: unknown[0]}
+	}
+	if err := m.checkErrorStates(); err != nil {
+		return nil, err
+	}
+	if loop := m.transientLoop(); loop != nil {
+		return nil, TransientLoopError{States: loop}
+	}
+	return m, nil
+}
+
+/**
+NewMachineWith: 与 NewMachine 相同, 但初始状态在构造时由 initialSelector 决定
+initialSelector 返回的状态不在定义中时返回 UnknownStateError
+*/
+func NewMachineWith(initialSelector func() string, events []EventDesc, callbacks Callbacks, opts ...Option) (*Machine, error) {
+	initialState := initialSelector()
+	m, _ := newMachine(initialState, events, callbacks, opts)
+	if !m.hasState(initialState) {
+		return nil, UnknownStateError{State: initialState}
+	}
+	return m, nil
+}
+
+// newMachine 构造 Machine, 同时返回无法解析的回调名(已排序)
+func newMachine(initialState string, events []EventDesc, callbacks Callbacks, opts []Option) (*Machine, []string) {
+	initialState = intern(initialState)
 	m := &Machine{
+		initial:         initialState,
 		current:         initialState,
 		transitionerObj: &transitionerStruct{},
 		transitions:     make(map[eKey]string),
+		transitionMeta:  make(map[eKey]map[string]interface{}),
+		transient:       make(map[string]int),
+		argCounts:       make(map[string]int),
 		callbacks:       make(map[cKey]Callback),
+		clock:           realClock{},
+		initEvent:       "__init__",
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	m.enteredAt = m.clock.Now()
 
 	// 构建状态迁移字典
 	allEvents := make(map[string]bool)
 	allStatus := make(map[string]bool)
 	for _, e := range events {
+		e.Name = intern(e.Name)
 		for _, src := range e.Src {
-			m.transitions[eKey{e.Name, src}] = e.Dst
+			src = intern(src)
+			dst := intern(e.Dst)
+			if isSelfDst(dst) {
+				dst = src
+			}
+			m.transitions[eKey{e.Name, src}] = dst
+			if e.Meta != nil {
+				m.transitionMeta[eKey{e.Name, src}] = e.Meta
+			}
 			allStatus[src] = true
-			allStatus[e.Dst] = true
+			allStatus[dst] = true
 		}
 		allEvents[e.Name] = true
+		if e.Transient {
+			m.transient[e.Name] = e.Priority
+		}
+		if e.ArgCount > 0 {
+			m.argCounts[e.Name] = e.ArgCount
+		}
+		for _, guard := range e.Guards {
+			m.addNamedGuard(e.Name, guard)
+		}
 	}
 
+	return m, m.registerCallbacks(callbacks, allEvents, allStatus)
+}
 
-	// 注册所有回调函数
+// registerCallbacks 注册所有回调函数, 返回无法解析的回调名(已排序)
+// 带前缀的名字按前缀解析, before_event/leave_state/enter_state/after_event 为全局回调;
+// 不带前缀的名字优先解析为状态的 enter 回调, 其次为事件的 after 回调,
+// 同时是状态名和事件名的回调会记录在 AmbiguousCallbacks 中;
+// on_leave_canceled 在 leave 回调取消迁移时执行, on_async_timeout 在异步迁移超时被取消时执行,
+// on_denied_<event> 在守卫拒绝该事件时执行, enter_tag_<tag> 在进入带有该标签的任意状态时执行,
+// once_enter_<state> 只在第一次进入该状态时执行
+func (m *Machine) registerCallbacks(callbacks Callbacks, allEvents, allStatus map[string]bool) []string {
+	var unknown []string
 	for name, fn := range callbacks {
 		var target string
 		var callbackType int
 		switch {
+		case name == "on_leave_canceled":
+			callbackType = callbackLeaveCanceled
+		case name == "on_async_timeout":
+			callbackType = callbackAsyncTimeout
+		case strings.HasPrefix(name, "on_denied_"):
+			target = strings.TrimPrefix(name, "on_denied_")
+			if _, ok := allEvents[target]; ok {
+				callbackType = callbackDenied
+			}
+		case strings.HasPrefix(name, "once_enter_"):
+			target = strings.TrimPrefix(name, "once_enter_")
+			if _, ok := allStatus[target]; ok {
+				callbackType = callbackEnterOnce
+			}
 		case strings.HasPrefix(name, "before_"):
-			target = strings.Trim(name, "before_")
+			target = strings.TrimPrefix(name, "before_")
 			if target == "event" {
+				target = ""
 				callbackType = callbackBeforeEvent
 			} else if _, ok := allEvents[target]; ok {
 				callbackType = callbackBeforeEvent
 			}
 		case strings.HasPrefix(name, "leave_"):
-			target = strings.Trim(name, "leave_")
+			target = strings.TrimPrefix(name, "leave_")
 			if target == "state" {
+				target = ""
 				callbackType = callbackLeaveState
 			} else if _, ok := allStatus[target]; ok {
 				callbackType = callbackLeaveState
 			}
+		case strings.HasPrefix(name, "enter_tag_") && !allStatus[strings.TrimPrefix(name, "enter_")]:
+			target = strings.TrimPrefix(name, "enter_tag_")
+			if len(m.StatesWithTag(target)) > 0 {
+				callbackType = callbackEnterTag
+			}
 		case strings.HasPrefix(name, "enter_"):
-			target = strings.Trim(name, "enter_")
+			target = strings.TrimPrefix(name, "enter_")
 			if target == "state" {
+				target = ""
 				callbackType = callbackEnterState
 			} else if _, ok := allStatus[target]; ok {
 				callbackType = callbackEnterState
 			}
 		case strings.HasPrefix(name, "after_"):
-			target = strings.Trim(name, "after_")
+			target = strings.TrimPrefix(name, "after_")
 			if target == "event" {
+				target = ""
 				callbackType = callbackAfterEvent
 			} else if _, ok := allEvents[target]; ok {
 				callbackType = callbackAfterEvent
@@ -83,15 +267,75 @@ func NewMachine(initialState string, events []EventDesc, callbacks Callbacks) *M
 			target = name
 			if _, ok := allStatus[target]; ok {
 				callbackType = callbackEnterState
+				if _, ok := allEvents[target]; ok {
+					m.ambiguousCallbacks = append(m.ambiguousCallbacks, name)
+				}
 			} else if _, ok := allEvents[target]; ok {
 				callbackType = callbackAfterEvent
 			}
 		}
 		if callbackType != callbackNone {
 			m.callbacks[cKey{target: target, callbackType: callbackType}] = fn
+		} else {
+			unknown = append(unknown, name)
 		}
 	}
-	return m
+	sort.Strings(m.ambiguousCallbacks)
+	sort.Strings(unknown)
+	return unknown
+}
+
+/**
+Start: 以伪事件(默认为 "__init__", 可用 WithInitEvent 修改)进入初始状态, 返回回调中设置的错误
+会执行初始状态的 enter 回调, OnTransition 和全局 after_event 回调, 它们看到的 Src 为空;
+重复调用不会再次执行回调, 而是返回 AlreadyStartedError
+*/
+func (m *Machine) Start() error {
+	gid, err := m.lockEventsOwned(m.initEvent)
+	if err != nil {
+		return err
+	}
+	defer m.unlockEvents(gid)
+
+	if m.started {
+		return AlreadyStartedError{}
+	}
+	m.started = true
+
+	start := m.clock.Now()
+	e := &Event{Machine: m, ID: m.nextEventID(), Event: m.initEvent, Dst: m.Current(), Args: emptyArgs}
+	// 与迁移的提交路径一样在不持有 stateMu 时执行回调, 回调中可以调用 SetState, DisableEvent 等方法
+	m.enterStateCallbacks(e, e.Dst)
+	m.transitionHooks(e)
+	m.afterEventCallbacks(e)
+	m.logTransition(e.ID, e.Event, "", start, e.Err)
+	return e.Err
+}
+
+/**
+SetName: 设置 Machine 的名字, 用于在多个 Machine 共用的日志中区分它们
+*/
+func (m *Machine) SetName(name string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.name = name
+}
+
+/**
+Name: 返回 Machine 的名字, 默认为空
+*/
+func (m *Machine) Name() string {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.name
+}
+
+/**
+AmbiguousCallbacks: 返回既是状态名又是事件名的无前缀回调名
+这些回调被注册为状态的 enter 回调, 如需注册为事件的 after 回调请使用 after_ 前缀
+*/
+func (m *Machine) AmbiguousCallbacks() []string {
+	return append([]string(nil), m.ambiguousCallbacks...)
 }
 
 func (m *Machine) Current() string {
@@ -104,13 +348,52 @@ func (m *Machine) Is(state string) bool {
 	return state == m.Current()
 }
 
+/**
+SetState: 强制设置当前状态, 不执行任何回调
+如果有尚未完成的异步迁移, 该迁移会被丢弃, 避免之后完成时覆盖这里设置的状态
+*/
 func (m *Machine) SetState(state string) {
 	m.stateMu.Lock()
 	defer m.stateMu.Unlock()
+	m.recordEntry(state)
 	m.current = state
+	m.transition = nil
 	return
 }
 
+/**
+Reset: 回到初始状态, 不执行任何回调
+会丢弃尚未完成的异步迁移, 清除 once_enter_<state> 回调的执行记录, 之后可以再次调用 Start
+*/
+func (m *Machine) Reset() {
+	m.stateMu.Lock()
+	m.recordEntry(m.initial)
+	m.current = m.initial
+	m.lastEvent = ""
+	m.started = false
+	m.transition = nil
+	m.pendingDst = ""
+	m.stateMu.Unlock()
+
+	m.onceMu.Lock()
+	m.entered = nil
+	m.onceMu.Unlock()
+}
+
+// firstEntry 记录进入 state, 返回是否为第一次进入
+func (m *Machine) firstEntry(state string) bool {
+	m.onceMu.Lock()
+	defer m.onceMu.Unlock()
+	if m.entered[state] {
+		return false
+	}
+	if m.entered == nil {
+		m.entered = make(map[string]bool)
+	}
+	m.entered[state] = true
+	return true
+}
+
 /**
 Can: 返回当前状态下event可否执行
 */
@@ -118,7 +401,7 @@ func (m *Machine) Can(event string) bool {
 	m.stateMu.RLock()
 	defer m.stateMu.RUnlock()
 	_, ok := m.transitions[eKey{event: event, src: m.current}]
-	return ok && (m.transition == nil)
+	return ok && !m.disabled[event] && (m.transition == nil || m.noTransitionGuard)
 }
 
 /**
@@ -127,13 +410,116 @@ AvailableTransitions: 返回当前状态下可以执行的转移
 func (m *Machine) AvailableTransitions() []string {
 	m.stateMu.RLock()
 	defer m.stateMu.RUnlock()
-	var transitions []string
+	return m.eventsFrom(m.current)
+}
+
+/**
+NextStates: 返回当前状态下执行一次迁移可以到达的所有状态(已排序, 去重), 不含只能经由被禁用的事件到达的状态
+*/
+func (m *Machine) NextStates() []string {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	seen := make(map[string]bool)
+	var states []string
+	for key, dst := range m.transitions {
+		if key.src == m.current && !m.disabled[key.event] && !seen[dst] {
+			seen[dst] = true
+			states = append(states, dst)
+		}
+	}
+	sort.Strings(states)
+	return states
+}
+
+/**
+AvailableFrom: 返回状态 state 下可以执行的事件(已排序, 不含被禁用的事件), 与当前状态无关
+*/
+func (m *Machine) AvailableFrom(state string) []string {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.eventsFrom(state)
+}
+
+// eventsFrom 返回从 state 出发可以执行的事件(已排序, 不含被禁用的事件), 调用方需持有 stateMu
+func (m *Machine) eventsFrom(state string) []string {
+	var events []string
 	for key := range m.transitions {
-		if key.src == m.current {
-			transitions = append(transitions, key.event)
+		if key.src == state && !m.disabled[key.event] {
+			events = append(events, key.event)
+		}
+	}
+	sort.Strings(events)
+	return events
+}
+
+/**
+TransitionMeta: 返回事件 event 从状态 src 出发的迁移上定义的元数据
+*/
+func (m *Machine) TransitionMeta(event, src string) (map[string]interface{}, bool) {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	meta, ok := m.transitionMeta[eKey{event, src}]
+	return meta, ok
+}
+
+/**
+AllowedFrom: 返回 events 中当前可以执行的事件(已排序)
+*/
+func (m *Machine) AllowedFrom(events ...string) []string {
+	var allowed []string
+	for _, event := range events {
+		if m.Can(event) {
+			allowed = append(allowed, event)
 		}
 	}
-	return transitions
+	sort.Strings(allowed)
+	return allowed
+}
+
+/**
+DisableEvent: 暂时禁用事件 event, 定义保持不变
+被禁用的事件不会出现在 Can/AvailableTransitions 中, 执行时返回 DisabledEventError
+*/
+func (m *Machine) DisableEvent(event string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.disabled == nil {
+		m.disabled = make(map[string]bool)
+	}
+	m.disabled[event] = true
+}
+
+/**
+EnableEvent: 重新启用被 DisableEvent 禁用的事件
+*/
+func (m *Machine) EnableEvent(event string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	delete(m.disabled, event)
+}
+
+/**
+AddTransition: 增加(或替换)一条从 src 经由 event 到 dst 的迁移, dst 为 "=" 或 "*" 时表示停留在 src
+*/
+func (m *Machine) AddTransition(event, src, dst string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if isSelfDst(dst) {
+		dst = src
+	}
+	m.transitions[eKey{interned(event), interned(src)}] = interned(dst)
+	m.reachable = nil
+}
+
+/**
+RemoveTransition: 删除从 src 经由 event 的迁移, 不存在时不做任何事
+*/
+func (m *Machine) RemoveTransition(event, src string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	delete(m.transitions, eKey{event, src})
+	delete(m.transitionMeta, eKey{event, src})
+	m.reachable = nil
 }
 
 /**
@@ -144,56 +530,335 @@ func (m *Machine) Cannot(event string) bool {
 }
 
 func (m *Machine) Event(event string, args ...interface{}) error {
+	return m.EventContext(context.Background(), event, args...)
+}
+
+/**
+EventContext: 与 Event 相同, 但在各个回调阶段之间检查 ctx
+ctx 被取消或超时时停止迁移并返回 ctx.Err(), 此时状态不会改变; 正在执行的回调不会被中断
+*/
+func (m *Machine) EventContext(ctx context.Context, event string, args ...interface{}) error {
+	_, err := m.eventE(ctx, event, args)
+	return err
+}
+
+/**
+EventE: 与 Event 相同, 同时返回本次迁移中传给回调的 Event, 便于查看 Src/Dst/Err 等字段
+返回的 Event 只是迁移完成时的快照, 不能再次使用; 事件无效或为宏事件时返回 nil
+*/
+func (m *Machine) EventE(event string, args ...interface{}) (*Event, error) {
+	return m.eventE(context.Background(), event, args)
+}
+
+/**
+EventStrict: 与 Event 相同, 但自迁移(目标状态与当前状态相同)时不执行任何回调, 直接返回 SelfTransitionError
+*/
+func (m *Machine) EventStrict(event string, args ...interface{}) error {
+	m.stateMu.RLock()
+	current := m.current
+	dst, ok := m.transitions[eKey{event, current}]
+	m.stateMu.RUnlock()
+	if ok && dst == current {
+		return SelfTransitionError{Event: event, State: current}
+	}
+
+	err := m.Event(event, args...)
+	if _, ok := err.(NoTransitionError); ok {
+		// 检查之后状态被其他 goroutine 改变, 仍然按自迁移处理
+		return SelfTransitionError{Event: event, State: m.Current()}
+	}
+	return err
+}
+
+/**
+Ensure: 确保通过 event 处于其目标状态, 用于幂等的命令处理
+当前状态下 event 的目标状态就是当前状态时直接返回 nil, 不执行任何回调; 否则与 Event 相同
+*/
+func (m *Machine) Ensure(event string) error {
+	m.stateMu.RLock()
+	current := m.current
+	dst, ok := m.transitions[eKey{event, current}]
+	m.stateMu.RUnlock()
+	if ok && dst == current {
+		return nil
+	}
+	return m.Event(event)
+}
+
+// nextEventID 返回下一个事件 ID, 同一个 Machine 内单调递增
+func (m *Machine) nextEventID() string {
+	return strconv.FormatUint(atomic.AddUint64(&m.eventSeq, 1), 10)
+}
+
+// lockEvents 获取 eventMu, 设置了 WithLockMetrics 时上报等待的耗时
+func (m *Machine) lockEvents() {
+	if m.lockMetrics == nil {
+		m.eventMu.Lock()
+		return
+	}
+	start := m.clock.Now()
 	m.eventMu.Lock()
-	defer m.eventMu.Unlock()
+	m.lockMetrics.ObserveLockWait(m.clock.Now().Sub(start))
+}
+
+// lockEventsOwned 获取 eventMu, 未关闭重入检测时记录持有者的 goroutine ID, 返回的 gid 需传给 unlockEvents
+// 当前 goroutine 已经持有 eventMu 时不加锁, 返回 ReentrantEventError(严格模式下 panic)
+func (m *Machine) lockEventsOwned(event string) (gid int64, err error) {
+	if !m.noReentrancyCheck || m.strictReentrancy || m.raceCheck {
+		gid = goroutineID()
+		if atomic.LoadInt64(&m.eventOwner) == gid {
+			if m.strictReentrancy {
+				panic("fsm: Event(\"" + event + "\") called from a callback of the same machine, " +
+					"this would deadlock; use Enqueue or EventAsync to fire it after the current event completes")
+			}
+			return 0, ReentrantEventError{event}
+		}
+	}
+	m.lockEvents()
+	if gid != 0 {
+		atomic.StoreInt64(&m.eventOwner, gid)
+	}
+	return gid, nil
+}
+
+// unlockEvents 释放 lockEventsOwned 获取的 eventMu
+func (m *Machine) unlockEvents(gid int64) {
+	if gid != 0 {
+		atomic.StoreInt64(&m.eventOwner, 0)
+	}
+	m.eventMu.Unlock()
+}
 
+// markInFlight 把 event 标记为正在执行, 已经在执行时返回 false
+func (m *Machine) markInFlight(event string) bool {
+	m.inFlightMu.Lock()
+	defer m.inFlightMu.Unlock()
+	if m.inFlight[event] {
+		return false
+	}
+	m.inFlight[event] = true
+	return true
+}
+
+// clearInFlight 清除 event 正在执行的标记
+func (m *Machine) clearInFlight(event string) {
+	m.inFlightMu.Lock()
+	defer m.inFlightMu.Unlock()
+	delete(m.inFlight, event)
+}
+
+// eventE 是 EventContext 和 EventE 的实现, 事件先经过 Use 注册的中间件
+func (m *Machine) eventE(ctx context.Context, event string, args []interface{}) (*Event, error) {
+	if middleware := m.middlewareChain(); len(middleware) > 0 {
+		return runMiddleware(middleware, event, args, func(event string, args []interface{}) (*Event, error) {
+			return m.lockedEventE(ctx, event, args)
+		})
+	}
+	return m.lockedEventE(ctx, event, args)
+}
+
+// lockedEventE 获取 eventMu 后执行事件
+func (m *Machine) lockedEventE(ctx context.Context, event string, args []interface{}) (*Event, error) {
+	if m.inFlight != nil {
+		if !m.markInFlight(event) {
+			return nil, DuplicateInFlightError{event}
+		}
+		defer m.clearInFlight(event)
+	}
+
+	// 回调中再次调用同一个 Machine 的 Event 会在 eventMu 上死锁, 启用重入检测时这里提前返回
+	gid, err := m.lockEventsOwned(event)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlockEvents(gid)
+	return m.dispatchLocked(ctx, event, args)
+}
+
+// dispatchLocked 执行事件或宏, 并执行 OnError 注册的函数和记录日志, 调用方需持有 eventMu
+func (m *Machine) dispatchLocked(ctx context.Context, event string, args []interface{}) (*Event, error) {
+	var from string
+	var start time.Time
+	if m.jsonLog != nil {
+		from, start = m.Current(), m.clock.Now()
+	}
+	var e *Event
+	var err error
+	var id string
+	if steps, ok := m.macros[event]; ok {
+		err = m.macroLocked(ctx, event, steps, args)
+	} else {
+		e, err = m.fireLocked(ctx, event, args)
+		m.errorHooks(e, err)
+		if e != nil {
+			id = e.ID
+		}
+	}
+	m.logTransition(id, event, from, start, err)
+	return e, err
+}
+
+/**
+EventWithTimeout: 以 d 为超时时间调用 EventContext
+回调没有在超时前完成时返回 context.DeadlineExceeded, 状态不会改变
+*/
+func (m *Machine) EventWithTimeout(d time.Duration, event string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return m.EventContext(ctx, event, args...)
+}
+
+/**
+ProcessEvent: 与 Event 相同(包括中间件, 宏, OnError 和日志), 但不获取 eventMu
+仅用于单 goroutine 的场景(例如测试), 不能与 Event 或其他 ProcessEvent 并发调用
+*/
+func (m *Machine) ProcessEvent(event string, args ...interface{}) error {
+	if middleware := m.middlewareChain(); len(middleware) > 0 {
+		_, err := runMiddleware(middleware, event, args, func(event string, args []interface{}) (*Event, error) {
+			return m.dispatchLocked(context.Background(), event, args)
+		})
+		return err
+	}
+	_, err := m.dispatchLocked(context.Background(), event, args)
+	return err
+}
+
+// eventLocked 执行事件 event, 调用方需持有 eventMu 或保证没有并发调用
+func (m *Machine) eventLocked(ctx context.Context, event string, args []interface{}) error {
+	_, err := m.fireLocked(ctx, event, args)
+	return err
+}
+
+// fireLocked 与 eventLocked 相同, 同时返回传给回调的 Event(尚未构造时为 nil)
+func (m *Machine) fireLocked(ctx context.Context, event string, args []interface{}) (*Event, error) {
 	m.stateMu.RLock()
 	defer m.stateMu.RUnlock()
+	defer m.enterCallbacks()()
 
-	if m.transition != nil {
-		return InTransitionError{event}
+	if m.transition != nil && !m.noTransitionGuard {
+		return nil, InTransitionError{event}
 	}
 
+	// 在构造 Event 之前尽早返回, 避免无效事件产生额外分配
 	dst, ok := m.transitions[eKey{event, m.current}]
 	if !ok {
 		for ekey := range m.transitions {
 			if ekey.event == event {
-				return InvalidEventError{
-					Event: event,
-					State: m.current,
+				return nil, InvalidEventError{
+					Event:     event,
+					State:     m.current,
+					Available: m.eventsFrom(m.current),
 				}
 			}
-			return UnknownEventError{event}
 		}
+		return nil, UnknownEventError{event}
+	}
+
+	if m.disabled[event] {
+		return nil, DisabledEventError{event}
+	}
+
+	if m.rateLimit != nil && dst != m.current && !m.rateLimit.allow(m.clock.Now()) {
+		return nil, RateLimitedError{event}
+	}
+
+	if want, ok := m.argCounts[event]; ok && want != len(args) {
+		return nil, ArgMismatchError{Event: event, Want: want, Got: len(args)}
+	}
+
+	if m.argsTransformer != nil {
+		args = m.argsTransformer(event, args)
+	}
+	if len(args) == 0 {
+		args = emptyArgs
+	}
+	e := &Event{
+		Machine:   m,
+		ID:        m.nextEventID(),
+		Event:     event,
+		Src:       m.current,
+		Dst:       dst,
+		Args:      args,
+		Meta:      m.transitionMeta[eKey{event, m.current}],
+		PrevEvent: m.lastEvent,
+		Ctx:       ctx,
+	}
+	if !m.checkGuards(e) {
+		if fn, ok := m.callbacks[cKey{event, callbackDenied}]; ok {
+			fn(e)
+		}
+		return e, TransitionDeniedError{Event: event, State: m.current, Guard: e.deniedBy}
+	}
+	if err := ctx.Err(); err != nil {
+		return e, err
 	}
 
-	e := &Event{m, event, m.current, dst, nil, args, false, false}
 	// 执行所有回调函数
+	start := m.phaseStart()
+	e.redirectable = true
 	err := m.beforeEventCallbacks(e)
+	e.redirectable = false
+	m.observePhase(event, PhaseBefore, start)
 	if err != nil {
-		return err
+		return e, err
+	}
+	dst = e.Dst
+	if err = ctx.Err(); err != nil {
+		return e, err
 	}
 
 	if m.current == dst {
+		start = m.phaseStart()
 		m.afterEventCallbacks(e)
-		return NoTransitionError{e.Err}
+		m.observePhase(event, PhaseAfter, start)
+		if m.noTransitionAsSuccess {
+			return e, e.Err
+		}
+		return e, NoTransitionError{e.Err}
 	}
 
 	// Setup the transition, call it later.
-	m.transition = func() {
+	m.setTransitionRLocked(dst, func() {
+		defer m.enterCallbacks()()
 		m.stateMu.Lock()
+		m.recordEntry(dst)
 		m.current = dst
+		m.lastEvent = event
 		m.stateMu.Unlock()
+		if m.rateLimit != nil {
+			m.rateLimit.take(m.clock.Now())
+		}
 
-		m.enterStateCallbacks(e)
+		start := m.phaseStart()
+		m.enterStateCallbacks(e, dst)
+		m.observePhase(event, PhaseEnter, start)
+		m.transitionHooks(e)
+		start = m.phaseStart()
 		m.afterEventCallbacks(e)
-	}
+		m.observePhase(event, PhaseAfter, start)
+		// 在提交路径上执行自动事件, 由 Transition 完成的异步迁移同样会触发
+		if e.Err == nil {
+			m.fireTransient()
+		}
+	})
 
-	if err = m.leaveStateCallbacks(e); err != nil {
+	start = m.phaseStart()
+	err = m.leaveStateCallbacks(e)
+	m.observePhase(event, PhaseLeave, start)
+	if err != nil {
 		if _, ok := err.(CanceledError); ok {
-			m.transition = nil
+			m.setTransitionRLocked("", nil)
+			if fn, ok := m.callbacks[cKey{"", callbackLeaveCanceled}]; ok {
+				fn(e)
+			}
+		} else if _, ok := err.(AsyncError); ok {
+			m.startAsyncTimeout(e)
 		}
-		return err
+		return e, err
+	}
+	if err = ctx.Err(); err != nil {
+		m.setTransitionRLocked("", nil)
+		return e, err
 	}
 
 	// 执行转移
@@ -201,20 +866,180 @@ func (m *Machine) Event(event string, args ...interface{}) error {
 	defer m.stateMu.RLock()
 	err = m.doTransition()
 	if err != nil {
-		return InternalError{}
+		return e, InternalError{Err: err}
 	}
+	return e, e.Err
+}
 
-	return e.Err
+// setTransitionRLocked 设置(fn 为 nil 时清除)尚未提交的迁移
+// 调用方持有 stateMu 的读锁, 这里临时换成写锁, 其他 goroutine 通过 IsTransitioning, PendingState 等方法并发读取这些字段
+func (m *Machine) setTransitionRLocked(dst string, fn func()) {
+	m.stateMu.RUnlock()
+	m.stateMu.Lock()
+	m.pendingDst = dst
+	m.transition = fn
+	m.stateMu.Unlock()
+	m.stateMu.RLock()
+}
+
+/**
+Transition: 完成由 leave 回调中 e.Async() 推迟的迁移
+没有进行中的迁移时返回 NotInTransitionError
+*/
+func (m *Machine) Transition() error {
+	gid, err := m.lockEventsOwned("Transition")
+	if err != nil {
+		return err
+	}
+	defer m.unlockEvents(gid)
+	return m.doTransition()
+}
+
+/**
+CancelTransition: 放弃由 leave 回调中 e.Async() 推迟的迁移, 状态保持不变
+没有进行中的迁移时返回 NotInTransitionError
+*/
+func (m *Machine) CancelTransition() error {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.transition == nil {
+		return NotInTransitionError{}
+	}
+	m.transition = nil
+	return nil
+}
+
+/**
+IsTransitioning: 返回是否有尚未完成的异步迁移
+*/
+func (m *Machine) IsTransitioning() bool {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.transition != nil
+}
+
+/**
+Advance: 执行当前状态下唯一可以执行的事件
+可执行的事件不是恰好一个时返回 AmbiguousAdvanceError
+*/
+func (m *Machine) Advance(args ...interface{}) error {
+	available := m.AvailableTransitions()
+	if len(available) != 1 {
+		return AmbiguousAdvanceError{Available: available}
+	}
+	return m.Event(available[0], args...)
+}
+
+/**
+Bind: 返回以预先绑定的参数执行 event 的函数, 调用时传入的参数追加在绑定参数之后
+*/
+func (m *Machine) Bind(event string, args ...interface{}) func(extra ...interface{}) error {
+	bound := append([]interface{}(nil), args...)
+	return func(extra ...interface{}) error {
+		if len(extra) == 0 {
+			return m.Event(event, bound...)
+		}
+		all := make([]interface{}, 0, len(bound)+len(extra))
+		all = append(append(all, bound...), extra...)
+		return m.Event(event, all...)
+	}
+}
+
+/**
+PendingState: 返回进行中的异步迁移的目标状态
+*/
+func (m *Machine) PendingState() (string, bool) {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	if m.transition == nil {
+		return "", false
+	}
+	return m.pendingDst, true
+}
+
+/**
+ClearIfPendingTo: 只有进行中的异步迁移以 dst 为目标状态时才放弃它, 返回是否放弃了迁移
+*/
+func (m *Machine) ClearIfPendingTo(dst string) bool {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.transition == nil || m.pendingDst != dst {
+		return false
+	}
+	m.transition = nil
+	return true
+}
+
+/**
+FireMatching: 按事件名顺序查找当前状态下第一个满足 pred 的事件并执行, 返回执行的事件名
+没有满足条件的事件时返回 NoMatchingEventError
+*/
+func (m *Machine) FireMatching(pred func(event, dst string) bool, args ...interface{}) (string, error) {
+	m.stateMu.RLock()
+	state := m.current
+	var matched string
+	for _, event := range m.eventsFrom(state) {
+		if pred(event, m.transitions[eKey{event, state}]) {
+			matched = event
+			break
+		}
+	}
+	m.stateMu.RUnlock()
+
+	if matched == "" {
+		return "", NoMatchingEventError{State: state}
+	}
+	return matched, m.Event(matched, args...)
 }
 
+/**
+SetArgsTransformer: 设置参数转换函数, 每次执行事件时在守卫和回调之前调用一次, 其返回值作为 e.Args
+在 ArgCount 检查之后调用, 因此检查的是调用方传入的参数个数; fn 为 nil 时取消转换
+*/
+func (m *Machine) SetArgsTransformer(fn func(event string, args []interface{}) []interface{}) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.argsTransformer = fn
+}
+
+/**
+FireOrElse: 执行 primary, 被守卫拒绝(TransitionDeniedError)时改为执行 fallback, 返回实际执行的事件名
+primary 的其他错误直接返回, 不会执行 fallback
+*/
+func (m *Machine) FireOrElse(primary, fallback string, args ...interface{}) (fired string, err error) {
+	err = m.Event(primary, args...)
+	if _, ok := err.(TransitionDeniedError); !ok {
+		return primary, err
+	}
+	return fallback, m.Event(fallback, args...)
+}
+
+/**
+EventAsync: 在新的 goroutine 中执行 Event, 结果通过返回的 channel 传递后关闭该 channel
+与其他事件一样通过 eventMu 串行执行, 但多个并发的 EventAsync 之间的执行顺序不做保证
+*/
+func (m *Machine) EventAsync(event string, args ...interface{}) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		defer close(result)
+		result <- m.Event(event, args...)
+	}()
+	return result
+}
+
+// beforeEventCallbacks 依次执行 before_<event> 和 before_event
 func (m *Machine) beforeEventCallbacks(e *Event) error {
 	if fn, ok := m.callbacks[cKey{
-		target:       m.current,
+		target:       e.Event,
 		callbackType: callbackBeforeEvent,
 	}]; ok {
 		fn(e)
 		if e.canceled {
-			return CanceledError{e.Err}
+			return CanceledError{Err: e.Err, Code: e.cancelCode}
 		}
 	}
 	if fn, ok := m.callbacks[cKey{
@@ -223,17 +1048,18 @@ func (m *Machine) beforeEventCallbacks(e *Event) error {
 	}]; ok {
 		fn(e)
 		if e.canceled {
-			return CanceledError{e.Err}
+			return CanceledError{Err: e.Err, Code: e.cancelCode}
 		}
 	}
 	return nil
 }
 
+// leaveStateCallbacks 依次执行 leave_<state> 和 leave_state
 func (m *Machine) leaveStateCallbacks(e *Event) error {
 	if fn, ok := m.callbacks[cKey{m.current, callbackLeaveState}]; ok {
 		fn(e)
 		if e.canceled {
-			return CanceledError{e.Err}
+			return CanceledError{Err: e.Err, Code: e.cancelCode}
 		} else if e.async {
 			return AsyncError{e.Err}
 		}
@@ -241,7 +1067,7 @@ func (m *Machine) leaveStateCallbacks(e *Event) error {
 	if fn, ok := m.callbacks[cKey{"", callbackLeaveState}]; ok {
 		fn(e)
 		if e.canceled {
-			return CanceledError{e.Err}
+			return CanceledError{Err: e.Err, Code: e.cancelCode}
 		} else if e.async {
 			return AsyncError{e.Err}
 		}
@@ -249,16 +1075,35 @@ func (m *Machine) leaveStateCallbacks(e *Event) error {
 	return nil
 }
 
-func (m *Machine) enterStateCallbacks(e *Event)  {
-	if fn, ok := m.callbacks[cKey{m.current, callbackEnterState}]; ok {
+// enterStateCallbacks 依次执行 once_enter_<state>(仅第一次进入时), enter_<state>,
+// state 各标签(按标签名排序)的 enter_tag_<tag>, enter_state 和 OnEnterStateExcept 注册的回调, 调用方不能持有 stateMu
+func (m *Machine) enterStateCallbacks(e *Event, state string) {
+	if fn, ok := m.callbacks[cKey{state, callbackEnterOnce}]; ok && m.firstEntry(state) {
 		fn(e)
 	}
+	if fn, ok := m.callbacks[cKey{state, callbackEnterState}]; ok {
+		if release, ok := acquireStateSlot(e, state); ok {
+			fn(e)
+			release()
+		}
+	}
+	for _, tag := range m.tagsOf(state) {
+		if fn, ok := m.callbacks[cKey{tag, callbackEnterTag}]; ok {
+			fn(e)
+		}
+	}
 	if fn, ok := m.callbacks[cKey{"", callbackEnterState}]; ok {
 		fn(e)
 	}
+	for _, cb := range m.enterExcept {
+		if !cb.excluded[state] {
+			cb.fn(e)
+		}
+	}
 }
 
-func (m *Machine) afterEventCallbacks(e *Event)  {
+// afterEventCallbacks 依次执行 after_<event> 和 after_event
+func (m *Machine) afterEventCallbacks(e *Event) {
 	if fn, ok := m.callbacks[cKey{e.Event, callbackAfterEvent}]; ok {
 		fn(e)
 	}
@@ -267,7 +1112,181 @@ func (m *Machine) afterEventCallbacks(e *Event)  {
 	}
 }
 
-func (m *Machine)doTransition() error {
+// exceptCallback 是 OnEnterStateExcept 注册的回调及其排除的状态
+type exceptCallback struct {
+	excluded map[string]bool
+	fn       Callback
+}
+
+/**
+OnEnterStateExcept: 注册进入任意状态时执行的回调, 进入 excluded 中的状态时不执行
+在全局 enter_state 回调之后按注册顺序执行, 每个回调有各自的排除列表, 不会影响已注册的 enter_state 回调
+*/
+func (m *Machine) OnEnterStateExcept(excluded []string, cb Callback) {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	set := make(map[string]bool, len(excluded))
+	for _, state := range excluded {
+		set[state] = true
+	}
+	m.enterExcept = append(m.enterExcept, exceptCallback{excluded: set, fn: cb})
+}
+
+/**
+OnTransition: 注册在每次完成状态迁移时调用的函数
+在 enter 回调之后, after_event 回调之前执行, 多个函数按注册顺序执行
+*/
+func (m *Machine) OnTransition(fn func(from, to, event string, args []interface{})) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.onTransition = append(m.onTransition, fn)
+}
+
+/**
+OnError: 注册在事件执行出错时调用的函数, 多个函数按注册顺序执行
+覆盖回调设置了 e.Err 以及 InternalError 的情况, 被拒绝或取消的事件不会触发; 函数收到的 e.Err 不为 nil;
+迁移完成后自动执行的事件(Transient)失败时, 函数收到该自动事件, e.Err 为 TransientEventError
+*/
+func (m *Machine) OnError(fn func(e *Event)) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.onError = append(m.onError, fn)
+}
+
+// errorHooks 在 e 出错时执行 OnError 注册的所有函数
+func (m *Machine) errorHooks(e *Event, err error) {
+	if e == nil || err == nil {
+		return
+	}
+	if _, ok := err.(CanceledError); ok {
+		return
+	}
+	if _, ok := err.(InternalError); ok && e.Err == nil {
+		e.Err = err
+	}
+	if e.Err == nil {
+		return
+	}
+	m.runErrorHooks(e)
+}
+
+// runErrorHooks 依次执行 OnError 注册的函数
+func (m *Machine) runErrorHooks(e *Event) {
+	m.stateMu.RLock()
+	hooks := m.onError
+	m.stateMu.RUnlock()
+	for _, fn := range hooks {
+		fn(e)
+	}
+}
+
+// transitionHooks 执行 OnTransition 注册的所有函数, 进入终止状态时再执行 OnFinal 注册的函数
+func (m *Machine) transitionHooks(e *Event) {
+	m.stateMu.RLock()
+	hooks := m.onTransition
+	var finalHooks []func(*Event)
+	if m.finalStates[e.Dst] {
+		finalHooks = m.onFinal
+	}
+	m.stateMu.RUnlock()
+	for _, fn := range hooks {
+		fn(e.Src, e.Dst, e.Event, e.Args)
+	}
+	for _, fn := range finalHooks {
+		fn(e)
+	}
+}
+
+// fireTransient 在进入新状态后执行该状态上优先级最高的自动事件, 调用方需持有 eventMu
+// 自动事件失败不影响已经完成的迁移, 错误包装为 TransientEventError 交给 OnError 注册的函数
+func (m *Machine) fireTransient() {
+	state := m.Current()
+	event, ok := m.transientFrom(state)
+	if !ok {
+		return
+	}
+	e, err := m.fireLocked(context.Background(), event, emptyArgs)
+	if err == nil {
+		return
+	}
+	if _, ok := err.(AsyncError); ok {
+		return
+	}
+	if e == nil {
+		e = &Event{Machine: m, Event: event, Src: state, Args: emptyArgs}
+	}
+	e.Err = TransientEventError{Event: event, State: state, Err: err}
+	m.runErrorHooks(e)
+}
+
+// transientFrom 返回进入状态 state 后要自动执行的事件: 错误状态的补偿事件, 或优先级最高的自动事件
+func (m *Machine) transientFrom(state string) (string, bool) {
+	if event, ok := m.errorStates[state]; ok {
+		return event, true
+	}
+	if len(m.transient) == 0 {
+		return "", false
+	}
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	var selected string
+	found := false
+	for _, event := range m.eventsFrom(state) {
+		priority, ok := m.transient[event]
+		if ok && (!found || priority > m.transient[selected]) {
+			selected = event
+			found = true
+		}
+	}
+	return selected, found
+}
+
+// transientLoop 检查自动事件是否构成环, 返回环上的状态(从名字最小的状态开始), 没有环时返回 nil
+func (m *Machine) transientLoop() []string {
+	next := make(map[string]string)
+	m.stateMu.RLock()
+	states := m.sortedStates()
+	m.stateMu.RUnlock()
+	for _, state := range states {
+		if event, ok := m.transientFrom(state); ok {
+			next[state] = m.transitions[eKey{event, state}]
+		}
+	}
+
+	done := make(map[string]bool)
+	for _, start := range states {
+		position := make(map[string]int)
+		var path []string
+		for state := start; !done[state]; {
+			if i, ok := position[state]; ok {
+				loop := path[i:]
+				min := 0
+				for j := range loop {
+					if loop[j] < loop[min] {
+						min = j
+					}
+				}
+				return append(loop[min:], loop[:min]...)
+			}
+			position[state] = len(path)
+			path = append(path, state)
+			dst, ok := next[state]
+			if !ok {
+				break
+			}
+			state = dst
+		}
+		for _, state := range path {
+			done[state] = true
+		}
+	}
+	return nil
+}
+
+func (m *Machine) doTransition() error {
 	return m.transitionerObj.transition(m)
 }
 
@@ -277,6 +1296,11 @@ const (
 	callbackLeaveState
 	callbackEnterState
 	callbackAfterEvent
+	callbackLeaveCanceled
+	callbackAsyncTimeout
+	callbackDenied
+	callbackEnterTag
+	callbackEnterOnce
 )
 
 type cKey struct {
@@ -0,0 +1,833 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// exampleEvents 是 example/alternate.go 中的状态机定义
+func exampleEvents() Events {
+	return Events{
+		{Name: "scan", Src: []string{"idle"}, Dst: "scanning"},
+		{Name: "working", Src: []string{"scanning"}, Dst: "scanning"},
+		{Name: "situation", Src: []string{"scanning"}, Dst: "scanning"},
+		{Name: "situation", Src: []string{"idle"}, Dst: "idle"},
+		{Name: "finish", Src: []string{"scanning"}, Dst: "idle"},
+	}
+}
+
+func TestReentrantEventReturnsError(t *testing.T) {
+	var inner error
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_scanning": func(e *Event) {
+			inner = e.Machine.Event("finish")
+		},
+	})
+
+	if err := m.Event("scan"); err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+	if _, ok := inner.(ReentrantEventError); !ok {
+		t.Fatalf("reentrant Event = %v, want ReentrantEventError", inner)
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("Current() = %q, want scanning", m.Current())
+	}
+}
+
+func TestStrictReentrancyPanics(t *testing.T) {
+	var recovered interface{}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_scanning": func(e *Event) {
+			defer func() { recovered = recover() }()
+			e.Machine.Event("finish")
+		},
+	}, WithStrictReentrancy())
+
+	m.Event("scan")
+	msg, _ := recovered.(string)
+	if !strings.Contains(msg, `Event("finish")`) || !strings.Contains(msg, "Enqueue") {
+		t.Fatalf("panic = %v, want a message naming the event and pointing to Enqueue", recovered)
+	}
+}
+
+func TestReentrantEventFromStartAndTransition(t *testing.T) {
+	var errs []error
+	fire := func(e *Event) {
+		errs = append(errs, e.Machine.Event("situation"))
+	}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_idle":     fire,
+		"leave_idle":     func(e *Event) { e.Async() },
+		"enter_scanning": fire,
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	if _, ok := m.Event("scan").(AsyncError); !ok {
+		t.Fatal("Event(scan) should be deferred by e.Async()")
+	}
+	if err := m.Transition(); err != nil {
+		t.Fatalf("Transition() = %v", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("callbacks ran %d times, want 2", len(errs))
+	}
+	for i, err := range errs {
+		if _, ok := err.(ReentrantEventError); !ok {
+			t.Errorf("reentrant Event #%d = %v, want ReentrantEventError", i, err)
+		}
+	}
+}
+
+func TestReentrantEventFromAsyncTimeout(t *testing.T) {
+	clock := newFakeClock()
+	var inner error
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_idle":       func(e *Event) { e.Async() },
+		"on_async_timeout": func(e *Event) { inner = e.Machine.Event("situation") },
+	}, WithClock(clock), WithAsyncTimeout(time.Second))
+
+	m.Event("scan")
+	clock.Advance(time.Second)
+	if _, ok := inner.(ReentrantEventError); !ok {
+		t.Fatalf("reentrant Event from on_async_timeout = %v, want ReentrantEventError", inner)
+	}
+}
+
+func BenchmarkEvent(b *testing.B) {
+	// 默认的重入检测每次都要解析 goroutine ID, 与关闭检测时对比开销
+	for _, bb := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"WithoutReentrancyCheck", []Option{WithoutReentrancyCheck()}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			m := NewMachine("idle", exampleEvents(), nil, bb.opts...)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m.Event("scan")
+				m.Event("finish")
+			}
+		})
+	}
+}
+
+func TestEventAllocs(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	// 每次迁移只分配 Event, 提交迁移的闭包和 Event.ID, 不为空参数分配切片
+	if allocs := testing.AllocsPerRun(100, func() {
+		m.Event("scan")
+		m.Event("finish")
+	}); allocs > 6 {
+		t.Errorf("a scan/finish pair allocates %v times, want at most 6", allocs)
+	}
+	// 无效和未知的事件在构造 Event 之前返回, 只分配返回的错误
+	if allocs := testing.AllocsPerRun(100, func() {
+		m.Event("nonexistent")
+	}); allocs > 1 {
+		t.Errorf("an unknown event allocates %v times, want at most 1", allocs)
+	}
+}
+
+func TestProcessEventMatchesEvent(t *testing.T) {
+	type result struct {
+		log     []string
+		errs    []string
+		current string
+		json    string
+	}
+	run := func(fire func(m *Machine, event string) error) result {
+		var r result
+		var out strings.Builder
+		record := func(e *Event) { r.log = append(r.log, e.Event+":"+e.Src+">"+e.Dst) }
+		m := NewMachine("idle", exampleEvents(), Callbacks{
+			"before_event": record,
+			"enter_state":  record,
+			"after_event":  record,
+			"after_finish": func(e *Event) { e.Err = errors.New("finish failed") },
+		}, WithJSONLogger(&out), WithClock(newFakeClock()))
+		m.RegisterMacro("cycle", []string{"scan", "finish"})
+		m.OnError(func(e *Event) { r.log = append(r.log, "error:"+e.Event) })
+
+		for _, event := range []string{"scan", "working", "nope", "finish", "cycle", "situation"} {
+			err := fire(m, event)
+			r.errs = append(r.errs, fmt.Sprintf("%T %v", err, err))
+		}
+		r.current = m.Current()
+		r.json = out.String()
+		return r
+	}
+
+	want := run(func(m *Machine, event string) error { return m.Event(event) })
+	got := run(func(m *Machine, event string) error { return m.ProcessEvent(event) })
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProcessEvent results differ from Event:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTransientPriority(t *testing.T) {
+	m := NewMachine("a", Events{
+		{Name: "go", Src: []string{"a"}, Dst: "b"},
+		{Name: "low", Src: []string{"b"}, Dst: "c", Transient: true, Priority: 1},
+		{Name: "high", Src: []string{"b"}, Dst: "d", Transient: true, Priority: 5},
+		{Name: "tie_b", Src: []string{"d"}, Dst: "f", Transient: true},
+		{Name: "tie_a", Src: []string{"d"}, Dst: "e", Transient: true},
+	}, nil)
+
+	if err := m.Event("go"); err != nil {
+		t.Fatalf("Event(go) = %v", err)
+	}
+	// b 上优先级最高的 high 到达 d, d 上优先级相同时按事件名选择 tie_a
+	if m.Current() != "e" {
+		t.Fatalf("Current() = %q, want e", m.Current())
+	}
+}
+
+func TestTransientFailureKeepsPrimaryResult(t *testing.T) {
+	events := Events{
+		{Name: "go", Src: []string{"a"}, Dst: "b"},
+		{Name: "next", Src: []string{"b"}, Dst: "c", Transient: true},
+	}
+	m := NewMachine("a", events, nil)
+	m.AddGuard("next", func(e *Event) bool { return false })
+	var reported []error
+	m.OnError(func(e *Event) { reported = append(reported, e.Err) })
+
+	if outcome, err := m.Fire("go"); outcome != Committed || err != nil {
+		t.Fatalf("Fire(go) = %v, %v; want Committed, nil", outcome, err)
+	}
+	if m.Current() != "b" {
+		t.Fatalf("Current() = %q, want b", m.Current())
+	}
+	if len(reported) != 1 {
+		t.Fatalf("OnError called %d times, want 1", len(reported))
+	}
+	te, ok := reported[0].(TransientEventError)
+	if !ok || te.Event != "next" || te.State != "b" {
+		t.Fatalf("OnError got %v, want TransientEventError for next from b", reported[0])
+	}
+	if _, ok := te.Err.(TransitionDeniedError); !ok {
+		t.Fatalf("TransientEventError.Err = %v, want TransitionDeniedError", te.Err)
+	}
+}
+
+func TestTransientSelfLoop(t *testing.T) {
+	events := Events{
+		{Name: "go", Src: []string{"a"}, Dst: "b"},
+		{Name: "spin", Src: []string{"b"}, Dst: "=", Transient: true},
+	}
+	m := NewMachine("a", events, nil)
+	if err := m.Event("go"); err != nil || m.Current() != "b" {
+		t.Fatalf("Event(go) = %v in %q, want nil in b", err, m.Current())
+	}
+
+	_, err := NewMachineChecked("a", events, nil)
+	loop, ok := err.(TransientLoopError)
+	if !ok || !reflect.DeepEqual(loop.States, []string{"b"}) {
+		t.Fatalf("NewMachineChecked = %v, want TransientLoopError on [b]", err)
+	}
+}
+
+func TestDedupeConcurrentEvents(t *testing.T) {
+	var mu sync.Mutex
+	var proceeded int
+	release := make(chan struct{})
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan": func(e *Event) {
+			mu.Lock()
+			proceeded++
+			mu.Unlock()
+			// 先进入回调的 goroutine 在另一个返回之前不会结束, 保证两次调用重叠
+			<-release
+		},
+	}, WithDedupeConcurrentEvents())
+
+	start := make(chan struct{})
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			<-start
+			errs <- m.Event("scan")
+		}()
+	}
+	close(start)
+
+	first := <-errs
+	close(release)
+	second := <-errs
+
+	if _, ok := first.(DuplicateInFlightError); !ok {
+		t.Fatalf("first returned error = %v, want DuplicateInFlightError", first)
+	}
+	if second != nil {
+		t.Fatalf("second returned error = %v, want nil", second)
+	}
+	if proceeded != 1 || m.Current() != "scanning" {
+		t.Fatalf("before_scan ran %d times, state %q; want 1, scanning", proceeded, m.Current())
+	}
+}
+
+func TestStartRunsInitialEnterOnce(t *testing.T) {
+	errInit := errors.New("init failed")
+	var entered int
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"enter_idle": func(e *Event) {
+			entered++
+			e.Err = errInit
+		},
+	})
+
+	if err := m.Start(); err != errInit {
+		t.Fatalf("first Start() = %v, want %v", err, errInit)
+	}
+	if _, ok := m.Start().(AlreadyStartedError); !ok {
+		t.Fatalf("second Start() should return AlreadyStartedError")
+	}
+	if entered != 1 {
+		t.Fatalf("enter_idle ran %d times, want 1", entered)
+	}
+}
+
+func TestStartEnterCallbackCanTakeWriteLock(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		// 这些方法都需要 stateMu 的写锁
+		"enter_idle": func(e *Event) {
+			e.Machine.DisableEvent("situation")
+			e.Machine.SetName("worker")
+			e.Machine.AddTransition("reset", "scanning", "idle")
+		},
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- m.Start() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Start() = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Start() deadlocked in enter_idle")
+	}
+	if m.Name() != "worker" || m.Can("situation") {
+		t.Fatalf("enter_idle changes not applied: name %q, Can(situation) = %v", m.Name(), m.Can("situation"))
+	}
+}
+
+func TestEventAsyncDeliversResult(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+
+	results := m.EventAsync("scan")
+	if err := <-results; err != nil {
+		t.Fatalf("EventAsync(scan) = %v", err)
+	}
+	if _, ok := <-results; ok {
+		t.Fatalf("result channel not closed after the result")
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("Current() = %q, want scanning", m.Current())
+	}
+
+	if _, ok := (<-m.EventAsync("scan")).(InvalidEventError); !ok {
+		t.Fatalf("EventAsync(scan) from scanning should deliver InvalidEventError")
+	}
+}
+
+func TestSetStateDiscardsPendingTransition(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_idle": func(e *Event) { e.Async() },
+	})
+
+	if _, ok := m.Event("scan").(AsyncError); !ok {
+		t.Fatalf("Event(scan) should start an async transition")
+	}
+	m.SetState("idle")
+
+	if _, ok := m.PendingState(); ok {
+		t.Fatalf("pending transition survived SetState")
+	}
+	if _, ok := m.Transition().(NotInTransitionError); !ok {
+		t.Fatalf("Transition() after SetState should return NotInTransitionError")
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q, want idle", m.Current())
+	}
+}
+
+func TestSelfDestinationSentinel(t *testing.T) {
+	for _, dst := range []string{"=", "*"} {
+		var pinged []string
+		m := NewMachine("idle", Events{
+			{Name: "scan", Src: []string{"idle"}, Dst: "scanning"},
+			{Name: "ping", Src: []string{"idle", "scanning"}, Dst: dst},
+		}, Callbacks{
+			"before_ping": func(e *Event) { pinged = append(pinged, e.Src+"->"+e.Dst) },
+		})
+
+		for _, event := range []string{"ping", "scan", "ping"} {
+			if err := m.Event(event); err != nil {
+				if _, ok := err.(NoTransitionError); !ok {
+					t.Fatalf("Dst %q: Event(%s) = %v", dst, event, err)
+				}
+			}
+		}
+		if m.Current() != "scanning" {
+			t.Fatalf("Dst %q: Current() = %q, want scanning", dst, m.Current())
+		}
+		if want := []string{"idle->idle", "scanning->scanning"}; !reflect.DeepEqual(pinged, want) {
+			t.Fatalf("Dst %q: before_ping saw %v, want %v", dst, pinged, want)
+		}
+	}
+}
+
+func TestTransitionMeta(t *testing.T) {
+	meta := map[string]interface{}{"label": "Start scanning", "role": "operator"}
+	var seen map[string]interface{}
+	m := NewMachine("idle", Events{
+		{Name: "scan", Src: []string{"idle"}, Dst: "scanning", Meta: meta},
+		{Name: "finish", Src: []string{"scanning"}, Dst: "idle"},
+	}, Callbacks{
+		"before_scan": func(e *Event) { seen = e.Meta },
+	})
+
+	if got, ok := m.TransitionMeta("scan", "idle"); !ok || !reflect.DeepEqual(got, meta) {
+		t.Fatalf("TransitionMeta(scan, idle) = %v, %v; want %v, true", got, ok, meta)
+	}
+	if _, ok := m.TransitionMeta("finish", "scanning"); ok {
+		t.Fatalf("TransitionMeta(finish, scanning) reported meta for a transition without Meta")
+	}
+	m.Event("scan")
+	if !reflect.DeepEqual(seen, meta) {
+		t.Fatalf("e.Meta = %v, want %v", seen, meta)
+	}
+}
+
+func TestNextStatesDeduplicates(t *testing.T) {
+	m := NewMachine("scanning", exampleEvents(), nil)
+
+	// working 和 situation 都停留在 scanning, finish 回到 idle
+	if want := []string{"idle", "scanning"}; !reflect.DeepEqual(m.NextStates(), want) {
+		t.Fatalf("NextStates() = %v, want %v", m.NextStates(), want)
+	}
+}
+
+func TestArgCountMismatch(t *testing.T) {
+	var before int
+	m := NewMachine("idle", Events{
+		{Name: "scan", Src: []string{"idle"}, Dst: "scanning", ArgCount: 1},
+	}, Callbacks{
+		"before_scan": func(e *Event) { before++ },
+	})
+
+	for _, args := range [][]interface{}{nil, {"a", "b"}} {
+		err := m.Event("scan", args...)
+		want := ArgMismatchError{Event: "scan", Want: 1, Got: len(args)}
+		if err != want {
+			t.Fatalf("Event(scan, %v) = %v, want %v", args, err, want)
+		}
+	}
+	if before != 0 {
+		t.Fatalf("before_scan ran %d times for mismatched args", before)
+	}
+	if err := m.Event("scan", "target"); err != nil {
+		t.Fatalf("Event(scan, target) = %v", err)
+	}
+}
+
+func TestTransientLoopRejected(t *testing.T) {
+	chain := Events{
+		{Name: "go", Src: []string{"a"}, Dst: "b"},
+		{Name: "auto1", Src: []string{"b"}, Dst: "c", Transient: true},
+		{Name: "auto2", Src: []string{"c"}, Dst: "d", Transient: true},
+	}
+	m, err := NewMachineChecked("a", chain, nil)
+	if err != nil {
+		t.Fatalf("NewMachineChecked(chain) = %v", err)
+	}
+	if err := m.Event("go"); err != nil || m.Current() != "d" {
+		t.Fatalf("Event(go) = %v in %q, want nil in d", err, m.Current())
+	}
+
+	loop := append(chain, EventDesc{Name: "auto3", Src: []string{"d"}, Dst: "b", Transient: true})
+	_, err = NewMachineChecked("a", loop, nil)
+	loopErr, ok := err.(TransientLoopError)
+	if !ok || !reflect.DeepEqual(loopErr.States, []string{"b", "c", "d"}) {
+		t.Fatalf("NewMachineChecked(loop) = %v, want TransientLoopError on [b c d]", err)
+	}
+}
+
+func TestNewMachineWithSelector(t *testing.T) {
+	for _, state := range []string{"idle", "scanning"} {
+		state := state
+		m, err := NewMachineWith(func() string { return state }, exampleEvents(), nil)
+		if err != nil || m.Current() != state {
+			t.Fatalf("NewMachineWith(%s) = %v, %v", state, m, err)
+		}
+	}
+
+	m, err := NewMachineWith(func() string { return "paused" }, exampleEvents(), nil)
+	if unknown, ok := err.(UnknownStateError); !ok || unknown.State != "paused" || m != nil {
+		t.Fatalf("NewMachineWith(paused) = %v, %v; want nil, UnknownStateError", m, err)
+	}
+}
+
+func TestEventWithTimeoutStopsAtPhaseBoundary(t *testing.T) {
+	var entered int
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan":    func(e *Event) { <-e.Ctx.Done() },
+		"enter_scanning": func(e *Event) { entered++ },
+	})
+
+	if err := m.EventWithTimeout(10*time.Millisecond, "scan"); err != context.DeadlineExceeded {
+		t.Fatalf("EventWithTimeout(scan) = %v, want context.DeadlineExceeded", err)
+	}
+	if m.Current() != "idle" || entered != 0 || m.IsTransitioning() {
+		t.Fatalf("after timeout: state %q, enter ran %d times, transitioning %v", m.Current(), entered, m.IsTransitioning())
+	}
+}
+
+func TestEventContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_idle": func(e *Event) { cancel() },
+	})
+
+	if err := m.EventContext(ctx, "scan"); err != context.Canceled {
+		t.Fatalf("EventContext(scan) = %v, want context.Canceled", err)
+	}
+	if m.Current() != "idle" || m.IsTransitioning() {
+		t.Fatalf("after cancel: state %q, transitioning %v", m.Current(), m.IsTransitioning())
+	}
+}
+
+func TestEventEReturnsEvent(t *testing.T) {
+	errDenied := errors.New("denied")
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_scanning": func(e *Event) { e.Cancel(errDenied) },
+	})
+
+	e, err := m.EventE("scan", "target")
+	if err != nil {
+		t.Fatalf("EventE(scan) = %v", err)
+	}
+	if e.Event != "scan" || e.Src != "idle" || e.Dst != "scanning" || e.Err != nil ||
+		!reflect.DeepEqual(e.Args, []interface{}{"target"}) {
+		t.Fatalf("EventE(scan) returned %+v", e)
+	}
+
+	e, err = m.EventE("finish")
+	if _, ok := err.(CanceledError); !ok {
+		t.Fatalf("EventE(finish) = %v, want CanceledError", err)
+	}
+	if e.Event != "finish" || e.Src != "scanning" || e.Dst != "idle" || e.Err != errDenied {
+		t.Fatalf("EventE(finish) returned %+v", e)
+	}
+
+	if e, err := m.EventE("scan"); e != nil || err == nil {
+		t.Fatalf("EventE(scan) from scanning = %v, %v; want nil event and an error", e, err)
+	}
+}
+
+func TestAllowedFrom(t *testing.T) {
+	m := NewMachine("scanning", exampleEvents(), nil)
+
+	got := m.AllowedFrom("working", "scan", "finish", "missing", "situation")
+	if want := []string{"finish", "situation", "working"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("AllowedFrom = %v, want %v", got, want)
+	}
+	if got := m.AllowedFrom("scan"); len(got) != 0 {
+		t.Fatalf("AllowedFrom(scan) = %v, want none", got)
+	}
+}
+
+func TestEventStrictRejectsSelfTransition(t *testing.T) {
+	var before int
+	m := NewMachine("scanning", exampleEvents(), Callbacks{
+		"before_working": func(e *Event) { before++ },
+	})
+
+	if _, ok := m.Event("working").(NoTransitionError); !ok || before != 1 {
+		t.Fatalf("Event(working) should run callbacks and return NoTransitionError")
+	}
+	err := m.EventStrict("working")
+	if want := (SelfTransitionError{Event: "working", State: "scanning"}); err != want {
+		t.Fatalf("EventStrict(working) = %v, want %v", err, want)
+	}
+	if before != 1 {
+		t.Fatalf("EventStrict ran callbacks for a self-transition")
+	}
+	if err := m.EventStrict("finish"); err != nil || m.Current() != "idle" {
+		t.Fatalf("EventStrict(finish) = %v in %q", err, m.Current())
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	m := NewMachine("idle", deadEndEvents(), nil)
+
+	if err := m.Advance(); err != nil || m.Current() != "running" {
+		t.Fatalf("Advance() from idle = %v in %q, want nil in running", err, m.Current())
+	}
+
+	err := m.Advance()
+	ambiguous, ok := err.(AmbiguousAdvanceError)
+	if !ok || !reflect.DeepEqual(ambiguous.Available, []string{"archive", "stop"}) {
+		t.Fatalf("Advance() from running = %v, want AmbiguousAdvanceError listing archive and stop", err)
+	}
+
+	m.Event("archive")
+	if err, ok := m.Advance().(AmbiguousAdvanceError); !ok || len(err.Available) != 0 {
+		t.Fatalf("Advance() from archived = %v, want AmbiguousAdvanceError with nothing available", err)
+	}
+}
+
+func TestStartEmitsInitRecord(t *testing.T) {
+	for _, name := range []string{"", "boot"} {
+		var opts []Option
+		want := "__init__"
+		if name != "" {
+			opts = append(opts, WithInitEvent(name))
+			want = name
+		}
+		var records []string
+		m := NewMachine("idle", exampleEvents(), Callbacks{
+			"enter_state": func(e *Event) { records = append(records, "enter "+e.Event+" "+e.Src+"->"+e.Dst) },
+			"after_event": func(e *Event) { records = append(records, "after "+e.Event) },
+		}, opts...)
+		m.OnTransition(func(from, to, event string, args []interface{}) {
+			records = append(records, "hook "+event+" "+from+"->"+to)
+		})
+
+		if err := m.Start(); err != nil {
+			t.Fatalf("Start() = %v", err)
+		}
+		expected := []string{"enter " + want + " ->idle", "hook " + want + " ->idle", "after " + want}
+		if !reflect.DeepEqual(records, expected) {
+			t.Fatalf("records = %v, want %v", records, expected)
+		}
+	}
+}
+
+func TestDisableEvent(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+
+	m.DisableEvent("scan")
+	if m.Can("scan") || !reflect.DeepEqual(m.AvailableTransitions(), []string{"situation"}) {
+		t.Fatalf("disabled scan still available: Can=%v, AvailableTransitions=%v", m.Can("scan"), m.AvailableTransitions())
+	}
+	if err := m.Event("scan"); err != (DisabledEventError{Event: "scan"}) {
+		t.Fatalf("Event(scan) while disabled = %v, want DisabledEventError", err)
+	}
+	// scanning 只能经由 scan 到达
+	if got := m.NextStates(); !reflect.DeepEqual(got, []string{"idle"}) {
+		t.Fatalf("NextStates() while scan is disabled = %v, want [idle]", got)
+	}
+
+	m.EnableEvent("scan")
+	if !m.Can("scan") {
+		t.Fatalf("Can(scan) = false after EnableEvent")
+	}
+	if got := m.NextStates(); !reflect.DeepEqual(got, []string{"idle", "scanning"}) {
+		t.Fatalf("NextStates() after EnableEvent = %v, want [idle scanning]", got)
+	}
+	if err := m.Event("scan"); err != nil || m.Current() != "scanning" {
+		t.Fatalf("Event(scan) after EnableEvent = %v in %q", err, m.Current())
+	}
+}
+
+func TestBindForwardsArgs(t *testing.T) {
+	var got [][]interface{}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"situation": func(e *Event) { got = append(got, e.Args) },
+	})
+	userArgs := []interface{}{"user", 7}
+	fire := m.Bind("situation", userArgs...)
+	// 修改原切片不影响已绑定的参数
+	userArgs[0] = "changed"
+
+	// situation 是自环, 回调执行后返回 NoTransitionError
+	for _, extra := range [][]interface{}{nil, {"extra"}, {1, 2}} {
+		if _, ok := fire(extra...).(NoTransitionError); !ok {
+			t.Fatalf("fire(%v) should return NoTransitionError", extra)
+		}
+	}
+
+	want := [][]interface{}{
+		{"user", 7},
+		{"user", 7, "extra"},
+		{"user", 7, 1, 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("args = %v, want %v", got, want)
+	}
+}
+
+func TestBindReturnsEventError(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	fire := m.Bind("finish")
+	if _, ok := fire().(InvalidEventError); !ok {
+		t.Fatalf("fire() should return InvalidEventError from idle")
+	}
+}
+
+func TestClearIfPendingTo(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_idle": func(e *Event) { e.Async() },
+	})
+	if _, ok := m.PendingState(); ok {
+		t.Fatal("PendingState() should report no pending transition before any event")
+	}
+	m.Event("scan")
+	if dst, ok := m.PendingState(); !ok || dst != "scanning" {
+		t.Fatalf("PendingState() = %q, %v; want scanning, true", dst, ok)
+	}
+
+	if m.ClearIfPendingTo("idle") {
+		t.Fatal("ClearIfPendingTo(idle) should not clear a transition to scanning")
+	}
+	if !m.IsTransitioning() {
+		t.Fatal("pending transition should remain after non-matching ClearIfPendingTo")
+	}
+
+	if !m.ClearIfPendingTo("scanning") {
+		t.Fatal("ClearIfPendingTo(scanning) should clear the pending transition")
+	}
+	if m.IsTransitioning() {
+		t.Fatal("IsTransitioning() should be false after ClearIfPendingTo")
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q, want idle", m.Current())
+	}
+	if m.ClearIfPendingTo("scanning") {
+		t.Fatal("ClearIfPendingTo should return false without a pending transition")
+	}
+}
+
+func TestPendingTransitionReadFromAnotherGoroutine(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_idle": func(e *Event) { e.Async() },
+	})
+
+	// 读取方只通过 Machine 的方法与写入方同步, 用 -race 运行时不能有数据竞争
+	seen := make(chan string)
+	go func() {
+		for {
+			m.IsStuck()
+			m.CanWithArgs("finish")
+			if dst, ok := m.PendingState(); ok && m.IsTransitioning() {
+				seen <- dst
+				return
+			}
+		}
+	}()
+
+	if _, ok := m.Event("scan").(AsyncError); !ok {
+		t.Fatal("Event(scan) should be deferred by e.Async()")
+	}
+	if dst := <-seen; dst != "scanning" {
+		t.Fatalf("PendingState() from another goroutine = %q, want scanning", dst)
+	}
+	if err := m.Transition(); err != nil {
+		t.Fatalf("Transition() = %v", err)
+	}
+	if _, ok := m.PendingState(); ok || m.Current() != "scanning" {
+		t.Fatalf("after Transition: PendingState ok = %v, Current() = %q", ok, m.Current())
+	}
+}
+
+func TestFireMatchingByDestination(t *testing.T) {
+	m := NewMachine("scanning", exampleEvents(), nil)
+	var seen []string
+	event, err := m.FireMatching(func(event, dst string) bool {
+		seen = append(seen, event)
+		return dst == "idle"
+	})
+	if err != nil || event != "finish" {
+		t.Fatalf("FireMatching() = %q, %v; want finish, nil", event, err)
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q, want idle", m.Current())
+	}
+	// 按事件名顺序检查, 第一个满足条件后停止
+	if want := []string{"finish"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("predicate saw %v, want %v", seen, want)
+	}
+}
+
+func TestFireMatchingNothing(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	event, err := m.FireMatching(func(event, dst string) bool { return dst == "missing" })
+	if event != "" {
+		t.Fatalf("FireMatching() event = %q, want empty", event)
+	}
+	if noMatch, ok := err.(NoMatchingEventError); !ok || noMatch.State != "idle" {
+		t.Fatalf("FireMatching() error = %v, want NoMatchingEventError for idle", err)
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q, want idle", m.Current())
+	}
+}
+
+func TestEnsureAlreadyThere(t *testing.T) {
+	called := false
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"situation": func(e *Event) { called = true },
+	})
+	if err := m.Ensure("situation"); err != nil {
+		t.Fatalf("Ensure(situation) = %v, want nil", err)
+	}
+	if called {
+		t.Fatal("Ensure should not run callbacks when already in the destination")
+	}
+	// 对比: Event 执行 after 回调并返回 NoTransitionError
+	if _, ok := m.Event("situation").(NoTransitionError); !ok || !called {
+		t.Fatal("Event(situation) should run after_situation and return NoTransitionError")
+	}
+}
+
+func TestEnsureNotThere(t *testing.T) {
+	called := false
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"scan": func(e *Event) { called = true },
+	})
+	if err := m.Ensure("scan"); err != nil {
+		t.Fatalf("Ensure(scan) = %v, want nil", err)
+	}
+	if m.Current() != "scanning" || !called {
+		t.Fatalf("Ensure(scan) should fire the event; Current() = %q", m.Current())
+	}
+	if _, ok := m.Ensure("scan").(InvalidEventError); !ok {
+		t.Fatal("Ensure(scan) from scanning should return InvalidEventError")
+	}
+}
+
+func TestAvailableFrom(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	tests := []struct {
+		state string
+		want  []string
+	}{
+		{"idle", []string{"scan", "situation"}},
+		{"scanning", []string{"finish", "situation", "working"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := m.AvailableFrom(tt.state); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AvailableFrom(%q) = %v, want %v", tt.state, got, tt.want)
+		}
+	}
+
+	// 与当前状态无关, 不包含被禁用的事件
+	m.DisableEvent("situation")
+	if got, want := m.AvailableFrom("scanning"), []string{"finish", "working"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("AvailableFrom(scanning) from idle = %v, want %v", got, want)
+	}
+}
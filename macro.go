@@ -0,0 +1,101 @@
+package fsm
+
+import "context"
+
+/**
+RegisterMacro: 注册一个宏事件, 调用 Event(name) 时按顺序执行 events 中的事件
+任意一步失败时, 会尽量通过反向迁移(从目标状态回到源状态的事件)回滚到起始状态;
+如果某一步没有定义反向迁移, 回滚会在那里停止, 因此宏只有在所有步骤都可反向时才是原子的
+*/
+func (m *Machine) RegisterMacro(name string, events []string) {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+	if m.macros == nil {
+		m.macros = make(map[string][]string)
+	}
+	m.macros[name] = append([]string(nil), events...)
+}
+
+// macroLocked 执行宏 name 的所有步骤, 调用方需持有 eventMu
+func (m *Machine) macroLocked(ctx context.Context, name string, steps []string, args []interface{}) error {
+	var done []Transition
+	for _, step := range steps {
+		src := m.Current()
+		err := m.eventLocked(ctx, step, args)
+		if err != nil {
+			if _, ok := err.(NoTransitionError); !ok {
+				m.rollbackLocked(done, args)
+				return MacroError{Macro: name, Event: step, Err: err}
+			}
+			continue
+		}
+		done = append(done, Transition{Event: step, Src: src, Dst: m.Current()})
+	}
+	return nil
+}
+
+// rollbackLocked 按相反顺序尽量撤销已完成的迁移, 调用方需持有 eventMu
+func (m *Machine) rollbackLocked(done []Transition, args []interface{}) {
+	for i := len(done) - 1; i >= 0; i-- {
+		reverse, ok := m.reverseEvent(done[i])
+		if !ok || m.eventLocked(context.Background(), reverse, args) != nil {
+			return
+		}
+	}
+}
+
+// reverseEvent 返回从 t.Dst 迁移回 t.Src 的事件, 有多个时取名字最小的一个
+func (m *Machine) reverseEvent(t Transition) (string, bool) {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	for _, event := range m.eventsFrom(t.Dst) {
+		if m.transitions[eKey{event, t.Dst}] == t.Src {
+			return event, true
+		}
+	}
+	return "", false
+}
+
+/**
+FireAtomic: 依次执行 events, 全部成功才保留结果; 任意一步失败时恢复到开始时的状态并返回该错误
+有未完成的异步迁移时直接返回 InTransitionError, 不执行任何一步;
+恢复只还原当前状态和 LastEvent, 不会执行反向迁移或任何回调, 已执行步骤的回调和统计产生的副作用需要调用方自行处理;
+执行期间持有事件锁, 其他事件要等到整批完成后才会执行; 每一步分别经过 Use 注册的中间件. 自迁移(NoTransitionError)不视为失败
+*/
+func (m *Machine) FireAtomic(events ...string) error {
+	if len(events) == 0 {
+		return nil
+	}
+	gid, err := m.lockEventsOwned(events[0])
+	if err != nil {
+		return err
+	}
+	defer m.unlockEvents(gid)
+
+	m.stateMu.RLock()
+	if m.transition != nil && !m.noTransitionGuard {
+		m.stateMu.RUnlock()
+		return InTransitionError{events[0]}
+	}
+	start, lastEvent := m.current, m.lastEvent
+	m.stateMu.RUnlock()
+
+	middleware := m.middlewareChain()
+	for _, event := range events {
+		var err error
+		if len(middleware) > 0 {
+			_, err = runMiddleware(middleware, event, emptyArgs, func(event string, args []interface{}) (*Event, error) {
+				return m.fireLocked(context.Background(), event, args)
+			})
+		} else {
+			err = m.eventLocked(context.Background(), event, emptyArgs)
+		}
+		if _, ok := err.(NoTransitionError); err != nil && !ok {
+			m.stateMu.Lock()
+			m.current, m.lastEvent = start, lastEvent
+			m.stateMu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// deployEvents 定义了一个三步的流程, 前两步可以反向迁移
+func deployEvents() Events {
+	return Events{
+		{Name: "build", Src: []string{"idle"}, Dst: "built"},
+		{Name: "test", Src: []string{"built"}, Dst: "tested"},
+		{Name: "release", Src: []string{"tested"}, Dst: "released"},
+		{Name: "unbuild", Src: []string{"built"}, Dst: "idle"},
+		{Name: "untest", Src: []string{"tested"}, Dst: "built"},
+	}
+}
+
+func TestMacroRunsStepsInOrder(t *testing.T) {
+	var steps []string
+	m := NewMachine("idle", deployEvents(), Callbacks{
+		"after_event": func(e *Event) { steps = append(steps, e.Event) },
+	})
+	m.RegisterMacro("deploy", []string{"build", "test", "release"})
+
+	if err := m.Event("deploy"); err != nil {
+		t.Fatalf("Event(deploy) = %v", err)
+	}
+	if m.Current() != "released" || len(steps) != 3 {
+		t.Fatalf("after deploy: state %q, steps %v; want released after 3 steps", m.Current(), steps)
+	}
+}
+
+func TestMacroRollsBackOnFailure(t *testing.T) {
+	var steps []string
+	m := NewMachine("idle", deployEvents(), Callbacks{
+		"before_release": func(e *Event) { e.Cancel() },
+		"after_event":    func(e *Event) { steps = append(steps, e.Event) },
+	})
+	m.RegisterMacro("deploy", []string{"build", "test", "release"})
+
+	err := m.Event("deploy")
+	macroErr, ok := err.(MacroError)
+	if !ok || macroErr.Macro != "deploy" || macroErr.Event != "release" {
+		t.Fatalf("Event(deploy) = %v, want MacroError at release", err)
+	}
+	if _, ok := macroErr.Err.(CanceledError); !ok {
+		t.Fatalf("MacroError.Err = %v, want CanceledError", macroErr.Err)
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q after rollback, want idle", m.Current())
+	}
+	want := []string{"build", "test", "untest", "unbuild"}
+	if !reflect.DeepEqual(steps, want) {
+		t.Fatalf("steps = %v, want %v", steps, want)
+	}
+}
+
+func TestMacroStepsSeePrevEvent(t *testing.T) {
+	prev := make(map[string]string)
+	m := NewMachine("idle", deployEvents(), Callbacks{
+		"before_event": func(e *Event) { prev[e.Event] = e.PrevEvent },
+	})
+	m.RegisterMacro("prepare", []string{"build", "test"})
+
+	if err := m.Event("prepare"); err != nil {
+		t.Fatalf("Event(prepare) = %v", err)
+	}
+	if want := map[string]string{"build": "", "test": "build"}; !reflect.DeepEqual(prev, want) {
+		t.Fatalf("PrevEvent = %v, want %v", prev, want)
+	}
+}
+
+func TestFireAtomicCommits(t *testing.T) {
+	m := NewMachine("idle", deployEvents(), nil)
+	if err := m.FireAtomic("build", "test", "release"); err != nil {
+		t.Fatalf("FireAtomic() = %v", err)
+	}
+	if m.Current() != "released" {
+		t.Fatalf("Current() = %q, want released", m.Current())
+	}
+}
+
+func TestFireAtomicRestoresOnFailure(t *testing.T) {
+	var entered []string
+	m := NewMachine("idle", deployEvents(), Callbacks{
+		"enter_state": func(e *Event) { entered = append(entered, e.Dst) },
+	})
+
+	err := m.FireAtomic("build", "test", "build")
+	if _, ok := err.(InvalidEventError); !ok {
+		t.Fatalf("FireAtomic() = %v, want InvalidEventError from the second build", err)
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q, want restored idle", m.Current())
+	}
+	// 恢复时不执行反向迁移或回调, 已执行步骤的回调保持执行过
+	if want := []string{"built", "tested"}; !reflect.DeepEqual(entered, want) {
+		t.Fatalf("entered = %v, want %v", entered, want)
+	}
+}
+
+func TestFireAtomicRestoresOnlyStateAndLastEvent(t *testing.T) {
+	var prev string
+	m := NewMachine("idle", deployEvents(), Callbacks{
+		"before_event": func(e *Event) { prev = e.PrevEvent },
+	})
+	if err := m.Event("build"); err != nil {
+		t.Fatalf("Event(build) = %v", err)
+	}
+	before := m.Stats()
+
+	if err := m.FireAtomic("test", "build"); err == nil {
+		t.Fatal("FireAtomic() = nil, want an error from build")
+	}
+	if m.Current() != "built" {
+		t.Fatalf("Current() = %q, want restored built", m.Current())
+	}
+	// 恢复不计为一次进入 built, 只保留已执行步骤进入 tested 的统计
+	after := m.Stats()
+	if after["built"].Entries != before["built"].Entries {
+		t.Fatalf("built Entries = %d, want %d", after["built"].Entries, before["built"].Entries)
+	}
+	if after["tested"].Entries != 1 {
+		t.Fatalf("tested Entries = %d, want 1", after["tested"].Entries)
+	}
+
+	if err := m.Event("test"); err != nil {
+		t.Fatalf("Event(test) = %v", err)
+	}
+	if prev != "build" {
+		t.Fatalf("PrevEvent = %q, want restored build", prev)
+	}
+}
+
+func TestFireAtomicRejectsPendingTransition(t *testing.T) {
+	ran := false
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_idle":    func(e *Event) { e.Async() },
+		"before_finish": func(e *Event) { ran = true },
+	})
+	if err := m.Event("scan"); err != nil {
+		if _, ok := err.(AsyncError); !ok {
+			t.Fatalf("Event(scan) = %v, want AsyncError", err)
+		}
+	}
+
+	err := m.FireAtomic("finish")
+	if _, ok := err.(InTransitionError); !ok {
+		t.Fatalf("FireAtomic() = %v, want InTransitionError", err)
+	}
+	if ran {
+		t.Fatal("FireAtomic ran a step while a transition was pending")
+	}
+	if !m.IsTransitioning() || m.Current() != "idle" {
+		t.Fatalf("IsTransitioning() = %v, Current() = %q, want the pending scan kept", m.IsTransitioning(), m.Current())
+	}
+	if err := m.Transition(); err != nil {
+		t.Fatalf("Transition() = %v", err)
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("Current() = %q, want scanning", m.Current())
+	}
+}
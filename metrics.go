@@ -0,0 +1,35 @@
+package fsm
+
+import "time"
+
+// 迁移过程中的各个阶段, 用于 MetricsCollector.ObserveTransitionPhase
+const (
+	PhaseBefore = "before"
+	PhaseLeave  = "leave"
+	PhaseEnter  = "enter"
+	PhaseAfter  = "after"
+)
+
+// MetricsCollector 接收 Machine 运行时的指标
+type MetricsCollector interface {
+	// ObserveTransitionPhase 记录事件 event 在 phase 阶段的回调耗时
+	ObserveTransitionPhase(event, phase string, d time.Duration)
+	// ObserveLockWait 记录一次事件等待获取事件锁的耗时, 只在设置了 WithLockMetrics 时调用
+	ObserveLockWait(d time.Duration)
+}
+
+// phaseStart 返回阶段计时的起点, 未设置收集器时返回零值, 避免在热路径上读取时钟
+func (m *Machine) phaseStart() time.Time {
+	if m.metrics == nil {
+		return time.Time{}
+	}
+	return m.clock.Now()
+}
+
+// observePhase 上报从 start 到现在 phase 阶段的耗时, 未设置收集器时不做任何事
+func (m *Machine) observePhase(event, phase string, start time.Time) {
+	if m.metrics == nil {
+		return
+	}
+	m.metrics.ObserveTransitionPhase(event, phase, m.clock.Now().Sub(start))
+}
@@ -0,0 +1,104 @@
+package fsm
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCollector 记录收到的所有指标
+type fakeCollector struct {
+	mu     sync.Mutex
+	phases map[string]time.Duration
+	waits  []time.Duration
+}
+
+func newFakeCollector() *fakeCollector {
+	return &fakeCollector{phases: make(map[string]time.Duration)}
+}
+
+func (c *fakeCollector) ObserveTransitionPhase(event, phase string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.phases[event+"/"+phase] += d
+}
+
+func (c *fakeCollector) ObserveLockWait(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+}
+
+func TestMetricsObserveEachPhase(t *testing.T) {
+	clock := newFakeClock()
+	collector := newFakeCollector()
+	slow := func(d time.Duration) Callback {
+		return func(e *Event) { clock.Advance(d) }
+	}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan":    slow(1 * time.Millisecond),
+		"leave_idle":     slow(2 * time.Millisecond),
+		"enter_scanning": slow(3 * time.Millisecond),
+		"after_scan":     slow(4 * time.Millisecond),
+	}, WithClock(clock), WithMetrics(collector))
+
+	if err := m.Event("scan"); err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+	want := map[string]time.Duration{
+		"scan/" + PhaseBefore: 1 * time.Millisecond,
+		"scan/" + PhaseLeave:  2 * time.Millisecond,
+		"scan/" + PhaseEnter:  3 * time.Millisecond,
+		"scan/" + PhaseAfter:  4 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(collector.phases, want) {
+		t.Fatalf("phases = %v, want %v", collector.phases, want)
+	}
+}
+
+// notifyClock 在每次调用 Now 时向 called 发送通知(不阻塞)
+type notifyClock struct {
+	*fakeClock
+	called chan struct{}
+}
+
+func (c notifyClock) Now() time.Time {
+	select {
+	case c.called <- struct{}{}:
+	default:
+	}
+	return c.fakeClock.Now()
+}
+
+func TestLockMetricsObserveWait(t *testing.T) {
+	clock := notifyClock{newFakeClock(), make(chan struct{}, 1)}
+	collector := newFakeCollector()
+	m := NewMachine("idle", exampleEvents(), nil, WithClock(clock), WithLockMetrics(collector))
+
+	// 丢弃创建 Machine 时的通知
+	select {
+	case <-clock.called:
+	default:
+	}
+
+	// 持有事件锁, 等 Event 开始计时后推进时钟再释放
+	m.eventMu.Lock()
+	done := make(chan error)
+	go func() { done <- m.Event("scan") }()
+	<-clock.called
+	clock.Advance(5 * time.Millisecond)
+	m.eventMu.Unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if want := []time.Duration{5 * time.Millisecond}; !reflect.DeepEqual(collector.waits, want) {
+		t.Fatalf("lock waits = %v, want %v", collector.waits, want)
+	}
+	if len(collector.phases) != 0 {
+		t.Fatalf("WithLockMetrics should not report phases, got %v", collector.phases)
+	}
+}
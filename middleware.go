@@ -0,0 +1,41 @@
+package fsm
+
+// EventFunc 是 Machine.Event 的函数签名
+type EventFunc func(event string, args ...interface{}) error
+
+// Middleware 包装 EventFunc, 可以在调用 next 之前返回错误来中止事件
+type Middleware func(next EventFunc) EventFunc
+
+/**
+Use: 注册包装事件执行的中间件, 先注册的中间件在最外层
+Event, EventContext, EventE, EventWithTimeout, Fire, ProcessEvent 以及基于它们的方法都会经过中间件;
+FireAtomic 的每一步分别经过中间件, 这时事件锁已被持有, 中间件中不能再调用同一个 Machine 的 Event
+*/
+func (m *Machine) Use(mw ...Middleware) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.middleware = append(m.middleware, mw...)
+}
+
+// middlewareChain 返回已注册的中间件
+func (m *Machine) middlewareChain() []Middleware {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.middleware
+}
+
+// runMiddleware 让事件依次经过 middleware, 最后由 inner 执行, 返回 inner 产生的 Event
+// 中间件可以修改传给 next 的事件名和参数, 不调用 next 时返回的 Event 为 nil
+func runMiddleware(middleware []Middleware, event string, args []interface{}, inner func(event string, args []interface{}) (*Event, error)) (*Event, error) {
+	var e *Event
+	next := EventFunc(func(event string, args ...interface{}) error {
+		var err error
+		e, err = inner(event, args)
+		return err
+	})
+	for i := len(middleware) - 1; i >= 0; i-- {
+		next = middleware[i](next)
+	}
+	err := next(event, args...)
+	return e, err
+}
@@ -0,0 +1,117 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrderAndShortCircuit(t *testing.T) {
+	errForbidden := errors.New("forbidden")
+	var order []string
+	logging := func(next EventFunc) EventFunc {
+		return func(event string, args ...interface{}) error {
+			order = append(order, "log "+event)
+			err := next(event, args...)
+			order = append(order, "log done")
+			return err
+		}
+	}
+	auth := func(next EventFunc) EventFunc {
+		return func(event string, args ...interface{}) error {
+			order = append(order, "auth "+event)
+			if event == "finish" {
+				return errForbidden
+			}
+			return next(event, args...)
+		}
+	}
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_event": func(e *Event) { order = append(order, "before "+e.Event) },
+	})
+	m.Use(logging, auth)
+
+	if err := m.Event("scan"); err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+	if err := m.Event("finish"); err != errForbidden {
+		t.Fatalf("Event(finish) = %v, want errForbidden", err)
+	}
+	want := []string{
+		"log scan", "auth scan", "before scan", "log done",
+		"log finish", "auth finish", "log done",
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("Current() = %q, want scanning", m.Current())
+	}
+}
+
+func TestMiddlewareCoversEveryEntryPoint(t *testing.T) {
+	errForbidden := errors.New("forbidden")
+	reject := func(next EventFunc) EventFunc {
+		return func(event string, args ...interface{}) error { return errForbidden }
+	}
+	entries := map[string]func(m *Machine) error{
+		"Event":        func(m *Machine) error { return m.Event("scan") },
+		"EventContext": func(m *Machine) error { return m.EventContext(context.Background(), "scan") },
+		"EventE": func(m *Machine) error {
+			e, err := m.EventE("scan")
+			if e != nil {
+				t.Errorf("EventE returned an Event for a rejected event")
+			}
+			return err
+		},
+		"EventWithTimeout": func(m *Machine) error { return m.EventWithTimeout(time.Second, "scan") },
+		"Fire": func(m *Machine) error {
+			outcome, err := m.Fire("scan")
+			if outcome != Errored {
+				t.Errorf("Fire outcome = %v, want errored", outcome)
+			}
+			return err
+		},
+		"ProcessEvent": func(m *Machine) error { return m.ProcessEvent("scan") },
+		"FireAtomic":   func(m *Machine) error { return m.FireAtomic("scan") },
+	}
+	for name, fire := range entries {
+		called := false
+		m := NewMachine("idle", exampleEvents(), Callbacks{
+			"before_event": func(e *Event) { called = true },
+		})
+		m.Use(reject)
+
+		if err := fire(m); err != errForbidden {
+			t.Errorf("%s = %v, want errForbidden", name, err)
+		}
+		if called || m.Current() != "idle" {
+			t.Errorf("%s bypassed the middleware: callbacks ran %v, state %q", name, called, m.Current())
+		}
+	}
+}
+
+func TestMiddlewareRewritesEvent(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	m.Use(func(next EventFunc) EventFunc {
+		return func(event string, args ...interface{}) error {
+			if event == "start" {
+				event = "scan"
+			}
+			return next(event, append(args, "audited")...)
+		}
+	})
+
+	e, err := m.EventE("start")
+	if err != nil {
+		t.Fatalf("EventE(start) = %v", err)
+	}
+	if e.Event != "scan" || !reflect.DeepEqual(e.Args, []interface{}{"audited"}) {
+		t.Fatalf("Event = %q with args %v, want scan with [audited]", e.Event, e.Args)
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("Current() = %q, want scanning", m.Current())
+	}
+}
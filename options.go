@@ -0,0 +1,91 @@
+package fsm
+
+// Option 用于在 NewMachine 时配置 Machine
+type Option func(m *Machine)
+
+/**
+WithClock: 替换 Machine 使用的时钟, 主要用于测试
+*/
+func WithClock(c Clock) Option {
+	return func(m *Machine) {
+		m.clock = c
+	}
+}
+
+/**
+WithMetrics: 设置指标收集器
+*/
+func WithMetrics(c MetricsCollector) Option {
+	return func(m *Machine) {
+		m.metrics = c
+	}
+}
+
+/**
+WithLockMetrics: 每次执行事件时把等待事件锁的耗时上报给 c, 用于分析锁竞争
+耗时由 Machine 的时钟测量
+*/
+func WithLockMetrics(c MetricsCollector) Option {
+	return func(m *Machine) {
+		m.lockMetrics = c
+	}
+}
+
+/**
+WithDedupeConcurrentEvents: 同一事件正在执行时, 其他 goroutine 再次执行该事件直接返回 DuplicateInFlightError,
+而不是等待前一个完成后再执行, 用于避免重复处理幂等的命令
+*/
+func WithDedupeConcurrentEvents() Option {
+	return func(m *Machine) {
+		m.inFlight = make(map[string]bool)
+	}
+}
+
+/**
+WithoutReentrancyCheck: 关闭重入检测, 回调中重入调用同一个 Machine 的 Event 会死锁
+默认每次执行事件时解析 goroutine ID, 以便重入时返回 ReentrantEventError; 确认不会重入且对开销敏感时可以关闭
+*/
+func WithoutReentrancyCheck() Option {
+	return func(m *Machine) {
+		m.noReentrancyCheck = true
+	}
+}
+
+/**
+WithStrictReentrancy: 重入调用 Event 时直接 panic, 而不是返回 ReentrantEventError
+便于在开发阶段尽早暴露问题, 优先于 WithoutReentrancyCheck
+*/
+func WithStrictReentrancy() Option {
+	return func(m *Machine) {
+		m.strictReentrancy = true
+	}
+}
+
+/**
+WithoutTransitionGuard: 去掉"上一次迁移未完成时拒绝新事件"的检查, 不再返回 InTransitionError
+允许在回调中通过 ProcessEvent 同步地链式触发事件; 只能在单 goroutine 中使用, 并发调用是不安全的
+*/
+func WithoutTransitionGuard() Option {
+	return func(m *Machine) {
+		m.noTransitionGuard = true
+	}
+}
+
+/**
+WithNoTransitionAsSuccess: 自迁移(源状态与目标状态相同)时返回 nil 而不是 NoTransitionError
+after_event 回调仍然会执行, 回调设置的 e.Err 会原样返回
+*/
+func WithNoTransitionAsSuccess() Option {
+	return func(m *Machine) {
+		m.noTransitionAsSuccess = true
+	}
+}
+
+/**
+WithInitEvent: 修改 Start 进入初始状态时使用的伪事件名, 默认为 "__init__"
+*/
+func WithInitEvent(name string) Option {
+	return func(m *Machine) {
+		m.initEvent = name
+	}
+}
@@ -0,0 +1,54 @@
+package fsm
+
+import "testing"
+
+func TestWithoutTransitionGuardAllowsChaining(t *testing.T) {
+	for _, guarded := range []bool{true, false} {
+		var opts []Option
+		if !guarded {
+			opts = append(opts, WithoutTransitionGuard())
+		}
+		var inner error
+		m := NewMachine("idle", exampleEvents(), Callbacks{
+			// leave 回调执行时迁移尚未完成, 默认会被拒绝
+			"leave_idle": func(e *Event) { inner = e.Machine.ProcessEvent("situation") },
+		}, opts...)
+
+		if err := m.Event("scan"); err != nil {
+			t.Fatalf("guarded=%v: Event(scan) = %v", guarded, err)
+		}
+		_, rejected := inner.(InTransitionError)
+		if rejected != guarded {
+			t.Fatalf("guarded=%v: chained ProcessEvent(situation) = %v", guarded, inner)
+		}
+		if !guarded {
+			if _, ok := inner.(NoTransitionError); !ok {
+				t.Fatalf("chained ProcessEvent(situation) = %v, want NoTransitionError", inner)
+			}
+		}
+		if m.Current() != "scanning" {
+			t.Fatalf("guarded=%v: Current() = %q, want scanning", guarded, m.Current())
+		}
+	}
+}
+
+func TestNoTransitionAsSuccess(t *testing.T) {
+	for _, asSuccess := range []bool{false, true} {
+		var opts []Option
+		if asSuccess {
+			opts = append(opts, WithNoTransitionAsSuccess())
+		}
+		var after int
+		m := NewMachine("idle", exampleEvents(), Callbacks{
+			"after_situation": func(e *Event) { after++ },
+		}, opts...)
+
+		err := m.Event("situation")
+		if _, isNoTransition := err.(NoTransitionError); asSuccess && err != nil || !asSuccess && !isNoTransition {
+			t.Fatalf("asSuccess=%v: Event(situation) = %v", asSuccess, err)
+		}
+		if after != 1 {
+			t.Fatalf("asSuccess=%v: after_situation ran %d times, want 1", asSuccess, after)
+		}
+	}
+}
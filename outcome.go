@@ -0,0 +1,77 @@
+package fsm
+
+import "strconv"
+
+// Outcome 是一次事件执行的结果分类
+type Outcome int
+
+const (
+	// Committed 表示状态迁移已完成
+	Committed Outcome = iota
+	// NoChange 表示自迁移, 状态没有改变
+	NoChange
+	// Denied 表示迁移被守卫拒绝
+	Denied
+	// Canceled 表示迁移被回调取消
+	Canceled
+	// Invalid 表示事件在当前状态下不能执行
+	Invalid
+	// Unknown 表示事件没有定义
+	Unknown
+	// Async 表示迁移被推迟, 需要调用 Transition 完成
+	Async
+	// Errored 表示其他错误
+	Errored
+)
+
+var outcomeNames = [...]string{
+	Committed: "committed",
+	NoChange:  "no_change",
+	Denied:    "denied",
+	Canceled:  "canceled",
+	Invalid:   "invalid",
+	Unknown:   "unknown",
+	Async:     "async",
+	Errored:   "errored",
+}
+
+func (o Outcome) String() string {
+	if o < 0 || int(o) >= len(outcomeNames) {
+		return "outcome(" + strconv.Itoa(int(o)) + ")"
+	}
+	return outcomeNames[o]
+}
+
+/**
+Fire: 与 Event 相同, 同时返回结果分类, 便于调用方用 switch 处理
+返回的错误与 Event 相同, 用于获取详细信息
+*/
+func (m *Machine) Fire(event string, args ...interface{}) (Outcome, error) {
+	e, err := m.EventE(event, args...)
+	if err == nil && e != nil && e.Src == e.Dst {
+		return NoChange, nil
+	}
+	return outcomeOf(err), err
+}
+
+// outcomeOf 根据 Event 返回的错误判断结果分类
+func outcomeOf(err error) Outcome {
+	switch err.(type) {
+	case nil:
+		return Committed
+	case NoTransitionError:
+		return NoChange
+	case TransitionDeniedError:
+		return Denied
+	case CanceledError:
+		return Canceled
+	case InvalidEventError:
+		return Invalid
+	case UnknownEventError:
+		return Unknown
+	case AsyncError:
+		return Async
+	default:
+		return Errored
+	}
+}
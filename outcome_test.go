@@ -0,0 +1,65 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFireOutcomes(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		event string
+		args  []interface{}
+		want  Outcome
+	}{
+		{"committed", "idle", "scan", nil, Committed},
+		{"self-transition", "idle", "situation", nil, NoChange},
+		{"guard", "idle", "scan", []interface{}{"deny"}, Denied},
+		{"before callback", "idle", "scan", []interface{}{"cancel"}, Canceled},
+		{"wrong state", "idle", "finish", nil, Invalid},
+		{"undefined", "idle", "missing", nil, Unknown},
+		{"leave callback", "scanning", "finish", []interface{}{"async"}, Async},
+		{"enter error", "scanning", "finish", []interface{}{"fail"}, Errored},
+	}
+	arg := func(e *Event) interface{} {
+		if len(e.Args) == 0 {
+			return nil
+		}
+		return e.Args[0]
+	}
+	for _, tt := range tests {
+		m := NewMachine(tt.state, exampleEvents(), Callbacks{
+			"before_event": func(e *Event) {
+				if arg(e) == "cancel" {
+					e.Cancel()
+				}
+			},
+			"leave_state": func(e *Event) {
+				if arg(e) == "async" {
+					e.Async()
+				}
+			},
+			"enter_state": func(e *Event) {
+				if arg(e) == "fail" {
+					e.Err = errors.New("enter failed")
+				}
+			},
+		})
+		m.AddGuard("scan", func(e *Event) bool { return arg(e) != "deny" })
+
+		got, err := m.Fire(tt.event, tt.args...)
+		if got != tt.want {
+			t.Errorf("%s: Fire(%s) = %v, %v; want %v", tt.name, tt.event, got, err, tt.want)
+		}
+		if got != Committed && got != NoChange && err == nil {
+			t.Errorf("%s: Fire(%s) returned %v without an error", tt.name, tt.event, got)
+		}
+	}
+}
+
+func TestOutcomeString(t *testing.T) {
+	if Committed.String() != "committed" || Errored.String() != "errored" || Outcome(42).String() != "outcome(42)" {
+		t.Fatalf("unexpected Outcome names: %v %v %v", Committed, Errored, Outcome(42))
+	}
+}
@@ -0,0 +1,113 @@
+package fsm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+)
+
+// binaryVersion 是 MarshalBinary 编码格式的版本
+const binaryVersion = 1
+
+/**
+Fingerprint: 返回由初始状态和迁移表计算出的定义指纹, 与回调和定义顺序无关
+*/
+func (m *Machine) Fingerprint() uint64 {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.fingerprint()
+}
+
+// fingerprint 计算定义指纹, 调用方需持有 stateMu
+func (m *Machine) fingerprint() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(m.initial))
+	for _, t := range m.sortedTransitions() {
+		h.Write([]byte{0})
+		h.Write([]byte(t.Event))
+		h.Write([]byte{0})
+		h.Write([]byte(t.Src))
+		h.Write([]byte{0})
+		h.Write([]byte(t.Dst))
+	}
+	return h.Sum64()
+}
+
+/**
+MarshalBinary: 以紧凑的二进制格式编码当前状态
+格式为 1 字节版本号, 8 字节定义指纹(大端), 以及当前状态名
+*/
+func (m *Machine) MarshalBinary() ([]byte, error) {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	data := make([]byte, 9, 9+len(m.current))
+	data[0] = binaryVersion
+	binary.BigEndian.PutUint64(data[1:9], m.fingerprint())
+	return append(data, m.current...), nil
+}
+
+/**
+UnmarshalBinary: 从 MarshalBinary 的结果恢复当前状态
+版本号不支持时返回 UnsupportedVersionError, 指纹与当前定义不一致时返回 DefinitionMismatchError;
+恢复状态与 SetState 相同, 不执行回调, 并丢弃尚未完成的异步迁移
+*/
+func (m *Machine) UnmarshalBinary(data []byte) error {
+	state, err := m.decodeBinary(data)
+	if err != nil {
+		return err
+	}
+	m.SetState(state)
+	return nil
+}
+
+/**
+CanRestore: 检查 MarshalBinary 的结果能否通过 UnmarshalBinary 恢复, 不修改 Machine
+返回的错误与 UnmarshalBinary 相同, 便于在恢复前决定是否需要迁移数据
+*/
+func (m *Machine) CanRestore(data []byte) error {
+	_, err := m.decodeBinary(data)
+	return err
+}
+
+// decodeBinary 校验 data 并返回其中的状态, 不修改 Machine
+func (m *Machine) decodeBinary(data []byte) (string, error) {
+	if len(data) < 9 {
+		return "", UnsupportedVersionError{}
+	}
+	if data[0] != binaryVersion {
+		return "", UnsupportedVersionError{Version: int(data[0])}
+	}
+	got := binary.BigEndian.Uint64(data[1:9])
+	if want := m.Fingerprint(); got != want {
+		return "", DefinitionMismatchError{Want: want, Got: got}
+	}
+	return string(data[9:]), nil
+}
+
+// machineDump 是 DumpJSON 输出的结构
+type machineDump struct {
+	Initial     string       `json:"initial"`
+	Current     string       `json:"current"`
+	Pending     bool         `json:"pending"`
+	States      []string     `json:"states"`
+	Events      []string     `json:"events"`
+	Transitions []Transition `json:"transitions"`
+}
+
+/**
+DumpJSON: 以 JSON 输出完整的定义和当前状态, 用于调试
+格式为 {initial, current, pending, states, events, transitions}, 列表都已排序
+*/
+func (m *Machine) DumpJSON() ([]byte, error) {
+	dump := machineDump{
+		States: m.AllStates(),
+		Events: m.AllEvents(),
+	}
+	m.stateMu.RLock()
+	dump.Initial = m.initial
+	dump.Current = m.current
+	dump.Pending = m.transition != nil
+	dump.Transitions = m.sortedTransitions()
+	m.stateMu.RUnlock()
+	return json.Marshal(dump)
+}
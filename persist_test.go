@@ -0,0 +1,105 @@
+package fsm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	src := NewMachine("idle", exampleEvents(), nil)
+	src.Event("scan")
+	data, err := src.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() = %v", err)
+	}
+	if len(data) != 9+len("scanning") || data[0] != binaryVersion {
+		t.Fatalf("MarshalBinary() = %v, want version byte, fingerprint and state", data)
+	}
+
+	dst := NewMachine("idle", exampleEvents(), nil)
+	if err := dst.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() = %v", err)
+	}
+	if dst.Current() != "scanning" {
+		t.Fatalf("Current() after UnmarshalBinary = %q, want scanning", dst.Current())
+	}
+}
+
+func TestBinaryRejectsMismatch(t *testing.T) {
+	data, _ := NewMachine("idle", exampleEvents(), nil).MarshalBinary()
+
+	other := NewMachine("idle", exampleEvents()[:4], nil)
+	err := other.UnmarshalBinary(data)
+	if mismatch, ok := err.(DefinitionMismatchError); !ok || mismatch.Want != other.Fingerprint() {
+		t.Fatalf("UnmarshalBinary with another definition = %v, want DefinitionMismatchError", err)
+	}
+
+	m := NewMachine("idle", exampleEvents(), nil)
+	m.Event("scan")
+	future := append([]byte(nil), data...)
+	future[0] = 2
+	if err, ok := m.UnmarshalBinary(future).(UnsupportedVersionError); !ok || err.Version != 2 {
+		t.Fatalf("UnmarshalBinary with version 2 = %v, want UnsupportedVersionError", err)
+	}
+	if _, ok := m.UnmarshalBinary(data[:5]).(UnsupportedVersionError); !ok {
+		t.Fatalf("UnmarshalBinary with truncated data should return UnsupportedVersionError")
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("rejected data changed the state to %q", m.Current())
+	}
+}
+
+func TestCanRestore(t *testing.T) {
+	src := NewMachine("idle", exampleEvents(), nil)
+	src.Event("scan")
+	data, _ := src.MarshalBinary()
+
+	m := NewMachine("idle", exampleEvents(), nil)
+	if err := m.CanRestore(data); err != nil {
+		t.Fatalf("CanRestore() with a compatible blob = %v", err)
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("CanRestore changed the state to %q", m.Current())
+	}
+
+	other := NewMachine("idle", exampleEvents()[:4], nil)
+	if _, ok := other.CanRestore(data).(DefinitionMismatchError); !ok {
+		t.Fatal("CanRestore() with another definition should return DefinitionMismatchError")
+	}
+	if other.Current() != "idle" {
+		t.Fatalf("rejected CanRestore changed the state to %q", other.Current())
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_scanning": func(e *Event) { e.Async() },
+	})
+	m.Event("scan")
+	m.Event("finish")
+
+	data, err := m.DumpJSON()
+	if err != nil {
+		t.Fatalf("DumpJSON() = %v", err)
+	}
+	var dump machineDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	want := machineDump{
+		Initial:     "idle",
+		Current:     "scanning",
+		Pending:     true,
+		States:      []string{"idle", "scanning"},
+		Events:      []string{"finish", "scan", "situation", "working"},
+		Transitions: exampleEdges(),
+	}
+	if !reflect.DeepEqual(dump, want) {
+		t.Fatalf("DumpJSON() = %s, want %+v", data, want)
+	}
+	if !strings.Contains(string(data), `{"event":"scan","src":"idle","dst":"scanning"}`) {
+		t.Fatalf("transitions not encoded with lower-case keys: %s", data)
+	}
+}
@@ -0,0 +1,55 @@
+package fsm
+
+import "sync"
+
+// queuedEvent 是 Enqueue 放入队列的一个事件
+type queuedEvent struct {
+	event string
+	args  []interface{}
+}
+
+// eventQueue 是等待 Drain 执行的事件队列
+type eventQueue struct {
+	mu     sync.Mutex
+	events []queuedEvent
+}
+
+/**
+Enqueue: 把事件放入队列, 不立即执行, 由 Drain 按放入的顺序执行
+可以在回调中调用, 用于在当前事件完成后继续触发后续事件
+*/
+func (m *Machine) Enqueue(event string, args ...interface{}) {
+	m.queue.mu.Lock()
+	defer m.queue.mu.Unlock()
+	m.queue.events = append(m.queue.events, queuedEvent{event: event, args: args})
+}
+
+/**
+Drain: 在调用方的 goroutine 中依次执行队列中的事件, 直到队列为空
+某个事件出错时返回该错误, 其后的事件保留在队列中; 执行过程中新放入的事件也会被执行
+*/
+func (m *Machine) Drain() error {
+	for {
+		m.queue.mu.Lock()
+		if len(m.queue.events) == 0 {
+			m.queue.mu.Unlock()
+			return nil
+		}
+		next := m.queue.events[0]
+		m.queue.events = m.queue.events[1:]
+		m.queue.mu.Unlock()
+
+		if err := m.Event(next.event, next.args...); err != nil {
+			return err
+		}
+	}
+}
+
+/**
+QueueDepth: 返回队列中等待 Drain 执行的事件个数, 可以并发调用
+*/
+func (m *Machine) QueueDepth() int {
+	m.queue.mu.Lock()
+	defer m.queue.mu.Unlock()
+	return len(m.queue.events)
+}
@@ -0,0 +1,77 @@
+package fsm
+
+import "testing"
+
+func TestDrainProcessesQueue(t *testing.T) {
+	m := NewMachine("a", Events{
+		{Name: "next", Src: []string{"a"}, Dst: "b"},
+		{Name: "next", Src: []string{"b"}, Dst: "c"},
+		{Name: "finish", Src: []string{"c"}, Dst: "done"},
+	}, Callbacks{
+		// 回调中放入的事件在当前队列之后执行
+		"enter_c": func(e *Event) { e.Machine.Enqueue("finish") },
+	})
+
+	m.Enqueue("next")
+	m.Enqueue("next")
+	if m.Current() != "a" {
+		t.Fatalf("Enqueue should not fire events; Current() = %q", m.Current())
+	}
+	if err := m.Drain(); err != nil {
+		t.Fatalf("Drain() = %v", err)
+	}
+	if m.Current() != "done" {
+		t.Fatalf("Current() = %q, want done", m.Current())
+	}
+	if err := m.Drain(); err != nil {
+		t.Fatalf("Drain() on an empty queue = %v", err)
+	}
+}
+
+func TestDrainStopsAtError(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	m.Enqueue("scan")
+	m.Enqueue("scan")
+	m.Enqueue("finish")
+
+	if _, ok := m.Drain().(InvalidEventError); !ok {
+		t.Fatal("Drain() should return the InvalidEventError of the second scan")
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("Current() = %q, want scanning", m.Current())
+	}
+	// 出错后剩余的事件保留在队列中
+	if err := m.Drain(); err != nil {
+		t.Fatalf("second Drain() = %v", err)
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q, want idle", m.Current())
+	}
+}
+
+func TestQueueDepth(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	if got := m.QueueDepth(); got != 0 {
+		t.Fatalf("QueueDepth() = %d, want 0", got)
+	}
+	m.Enqueue("scan")
+	m.Enqueue("working")
+	m.Enqueue("finish")
+	if got := m.QueueDepth(); got != 3 {
+		t.Fatalf("QueueDepth() after Enqueue = %d, want 3", got)
+	}
+
+	// working 是自迁移, Drain 在此返回 NoTransitionError, 剩余 finish
+	if _, ok := m.Drain().(NoTransitionError); !ok {
+		t.Fatal("Drain() should stop at the working self-loop")
+	}
+	if got := m.QueueDepth(); got != 1 {
+		t.Fatalf("QueueDepth() after partial Drain = %d, want 1", got)
+	}
+	if err := m.Drain(); err != nil {
+		t.Fatalf("Drain() = %v", err)
+	}
+	if got := m.QueueDepth(); got != 0 {
+		t.Fatalf("QueueDepth() after Drain = %d, want 0", got)
+	}
+}
@@ -0,0 +1,25 @@
+package fsm
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// enterCallbacks 在启用 WithRaceCheck 时记录正在执行回调的 goroutine,
+// 其他 goroutine 在此期间进入同一个 Machine 的回调时 panic; 返回的函数在回调执行完后调用
+func (m *Machine) enterCallbacks() (leave func()) {
+	if !m.raceCheck {
+		return func() {}
+	}
+	gid := goroutineID()
+	if atomic.CompareAndSwapInt64(&m.callbackOwner, 0, gid) {
+		return func() {
+			atomic.StoreInt64(&m.callbackOwner, 0)
+		}
+	}
+	if owner := atomic.LoadInt64(&m.callbackOwner); owner != gid {
+		panic("fsm: callbacks entered from goroutine " + strconv.FormatInt(gid, 10) +
+			" while goroutine " + strconv.FormatInt(owner, 10) + " is running a transition on the same machine")
+	}
+	return func() {}
+}
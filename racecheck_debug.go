@@ -0,0 +1,14 @@
+//go:build fsmdebug
+// +build fsmdebug
+
+package fsm
+
+/**
+WithRaceCheck: 检测并发误用, 只在使用 fsmdebug 构建标签时可用
+一个 goroutine 正在执行迁移时, 另一个 goroutine 进入同一个 Machine 的回调(例如并发调用 ProcessEvent)会 panic
+*/
+func WithRaceCheck() Option {
+	return func(m *Machine) {
+		m.raceCheck = true
+	}
+}
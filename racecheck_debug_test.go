@@ -0,0 +1,58 @@
+//go:build fsmdebug
+// +build fsmdebug
+
+package fsm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRaceCheckPanicsOnConcurrentCallbacks(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan": func(e *Event) {
+			close(entered)
+			<-release
+		},
+	}, WithRaceCheck())
+
+	done := make(chan error)
+	go func() { done <- m.Event("scan") }()
+	<-entered
+
+	// ProcessEvent 不获取 eventMu, 在另一个 goroutine 中进入回调
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		m.ProcessEvent("situation")
+	}()
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Event(scan) = %v", err)
+	}
+
+	msg, _ := recovered.(string)
+	if !strings.Contains(msg, "is running a transition on the same machine") {
+		t.Fatalf("recovered %v, want race check panic", recovered)
+	}
+}
+
+func TestRaceCheckAllowsSequentialUse(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		// 同一个 goroutine 在回调中再次进入回调是合法的
+		"after_scan": func(e *Event) { e.Machine.ProcessEvent("working") },
+	}, WithRaceCheck())
+
+	for _, event := range []string{"scan", "finish", "scan"} {
+		done := make(chan error)
+		go func(event string) { done <- m.Event(event) }(event)
+		if err := <-done; err != nil {
+			t.Fatalf("Event(%s) = %v", event, err)
+		}
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("Current() = %q, want scanning", m.Current())
+	}
+}
@@ -0,0 +1,46 @@
+package fsm
+
+import "time"
+
+// rateLimiter 是限制迁移速率的令牌桶, 由 eventMu 保护
+type rateLimiter struct {
+	capacity float64
+	per      time.Duration
+	tokens   float64
+	last     time.Time
+}
+
+/**
+WithRateLimit: 限制每 per 时间内最多完成 n 次状态迁移(令牌桶)
+超过限制时 Event 返回 RateLimitedError; 只有完成的迁移会消耗令牌, 被拒绝或取消的事件不会
+*/
+func WithRateLimit(n int, per time.Duration) Option {
+	return func(m *Machine) {
+		m.rateLimit = &rateLimiter{capacity: float64(n), per: per}
+	}
+}
+
+// refill 按经过的时间补充令牌, 第一次调用时装满令牌桶
+func (r *rateLimiter) refill(now time.Time) {
+	if r.last.IsZero() {
+		r.tokens = r.capacity
+	} else if elapsed := now.Sub(r.last); elapsed > 0 {
+		r.tokens += r.capacity * float64(elapsed) / float64(r.per)
+		if r.tokens > r.capacity {
+			r.tokens = r.capacity
+		}
+	}
+	r.last = now
+}
+
+// allow 返回当前是否还有令牌
+func (r *rateLimiter) allow(now time.Time) bool {
+	r.refill(now)
+	return r.tokens >= 1
+}
+
+// take 消耗一个令牌
+func (r *rateLimiter) take(now time.Time) {
+	r.refill(now)
+	r.tokens--
+}
@@ -0,0 +1,56 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	clock := newFakeClock()
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_scan": func(e *Event) {
+			if len(e.Args) > 0 {
+				e.Cancel()
+			}
+		},
+	}, WithClock(clock), WithRateLimit(2, time.Second))
+
+	fire := func(event string, args ...interface{}) error {
+		t.Helper()
+		err := m.Event(event, args...)
+		if _, limited := err.(RateLimitedError); err != nil && !limited {
+			if _, canceled := err.(CanceledError); !canceled {
+				t.Fatalf("Event(%s) = %v", event, err)
+			}
+		}
+		return err
+	}
+	limited := func(err error) bool {
+		_, ok := err.(RateLimitedError)
+		return ok
+	}
+
+	// 被取消的迁移不消耗令牌
+	fire("scan", "cancel")
+	if fire("scan") != nil || fire("finish") != nil {
+		t.Fatalf("first two transitions should pass")
+	}
+	if !limited(fire("scan")) {
+		t.Fatalf("third transition within a second should be rate limited")
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q, want idle", m.Current())
+	}
+	// 自迁移不改变状态, 不受限制
+	if err := m.Event("situation"); limited(err) {
+		t.Fatalf("self-transition was rate limited")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if fire("scan") != nil {
+		t.Fatalf("transition after refilling one token should pass")
+	}
+	if !limited(fire("finish")) {
+		t.Fatalf("second transition after half a second should be rate limited")
+	}
+}
@@ -0,0 +1,31 @@
+package fsm
+
+/**
+SetRolePolicy: 设置角色 role 可以通过 EventAs 执行的事件, 替换该角色原有的设置
+没有设置过的角色不能执行任何事件
+*/
+func (m *Machine) SetRolePolicy(role string, allowed ...string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.rolePolicy == nil {
+		m.rolePolicy = make(map[string]map[string]bool)
+	}
+	events := make(map[string]bool, len(allowed))
+	for _, event := range allowed {
+		events[event] = true
+	}
+	m.rolePolicy[role] = events
+}
+
+/**
+EventAs: 以角色 role 的身份执行事件, 角色不允许执行该事件时不执行任何回调, 直接返回 UnauthorizedEventError
+*/
+func (m *Machine) EventAs(role string, event string, args ...interface{}) error {
+	m.stateMu.RLock()
+	allowed := m.rolePolicy[role][event]
+	m.stateMu.RUnlock()
+	if !allowed {
+		return UnauthorizedEventError{Role: role, Event: event}
+	}
+	return m.Event(event, args...)
+}
@@ -0,0 +1,36 @@
+package fsm
+
+import "testing"
+
+func TestEventAsRolePolicy(t *testing.T) {
+	called := false
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"before_event": func(e *Event) { called = true },
+	})
+	m.SetRolePolicy("operator", "scan", "finish")
+	m.SetRolePolicy("viewer", "situation")
+
+	err := m.EventAs("viewer", "scan")
+	if unauthorized, ok := err.(UnauthorizedEventError); !ok || unauthorized.Role != "viewer" || unauthorized.Event != "scan" {
+		t.Fatalf("EventAs(viewer, scan) = %v, want UnauthorizedEventError", err)
+	}
+	if called {
+		t.Fatal("no callback should run for an unauthorized event")
+	}
+	if _, ok := m.EventAs("guest", "scan").(UnauthorizedEventError); !ok {
+		t.Fatal("role without a policy should not fire any event")
+	}
+
+	if err := m.EventAs("operator", "scan"); err != nil {
+		t.Fatalf("EventAs(operator, scan) = %v", err)
+	}
+	if m.Current() != "scanning" {
+		t.Fatalf("Current() = %q, want scanning", m.Current())
+	}
+	if _, ok := m.EventAs("viewer", "situation").(NoTransitionError); !ok {
+		t.Fatal("EventAs(viewer, situation) should pass the policy and fire the self-loop")
+	}
+	if _, ok := m.EventAs("operator", "working").(UnauthorizedEventError); !ok {
+		t.Fatal("EventAs(operator, working) should be unauthorized")
+	}
+}
@@ -0,0 +1,65 @@
+package fsm
+
+import "time"
+
+/**
+FireAfter: 在 d 之后异步执行事件 event, 返回的函数用于取消尚未执行的事件
+事件执行的结果会被丢弃, 需要结果时请在回调中处理
+*/
+func (m *Machine) FireAfter(d time.Duration, event string, args ...interface{}) (cancel func() bool) {
+	m.scheduleMu.Lock()
+	defer m.scheduleMu.Unlock()
+
+	if m.scheduled == nil {
+		m.scheduled = make(map[uint64]Timer)
+	}
+	m.scheduleSeq++
+	id := m.scheduleSeq
+	m.scheduled[id] = m.clock.AfterFunc(d, func() {
+		if m.unschedule(id) == nil {
+			return
+		}
+		m.Event(event, args...)
+	})
+	return func() bool {
+		timer := m.unschedule(id)
+		if timer == nil {
+			return false
+		}
+		timer.Stop()
+		return true
+	}
+}
+
+/**
+PendingScheduled: 返回尚未执行且未被取消的定时事件个数
+*/
+func (m *Machine) PendingScheduled() int {
+	m.scheduleMu.Lock()
+	defer m.scheduleMu.Unlock()
+	return len(m.scheduled)
+}
+
+/**
+Stop: 取消所有尚未执行的定时事件
+*/
+func (m *Machine) Stop() {
+	m.scheduleMu.Lock()
+	defer m.scheduleMu.Unlock()
+	for id, timer := range m.scheduled {
+		timer.Stop()
+		delete(m.scheduled, id)
+	}
+}
+
+// unschedule 移除定时事件 id 并返回它的定时器, 已经执行或取消时返回 nil
+func (m *Machine) unschedule(id uint64) Timer {
+	m.scheduleMu.Lock()
+	defer m.scheduleMu.Unlock()
+	timer, ok := m.scheduled[id]
+	if !ok {
+		return nil
+	}
+	delete(m.scheduled, id)
+	return timer
+}
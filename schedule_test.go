@@ -0,0 +1,46 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingScheduled(t *testing.T) {
+	clock := newFakeClock()
+	m := NewMachine("idle", exampleEvents(), nil, WithClock(clock))
+
+	m.FireAfter(1*time.Second, "scan")
+	cancelSituation := m.FireAfter(2*time.Second, "situation")
+	m.FireAfter(3*time.Second, "finish")
+	m.FireAfter(4*time.Second, "scan")
+	if n := m.PendingScheduled(); n != 4 {
+		t.Fatalf("PendingScheduled() = %d after scheduling, want 4", n)
+	}
+
+	if !cancelSituation() {
+		t.Fatalf("cancel returned false for a pending event")
+	}
+	if cancelSituation() {
+		t.Fatalf("second cancel returned true")
+	}
+	if n := m.PendingScheduled(); n != 3 {
+		t.Fatalf("PendingScheduled() = %d after cancel, want 3", n)
+	}
+
+	clock.Advance(3 * time.Second)
+	if n := m.PendingScheduled(); n != 1 {
+		t.Fatalf("PendingScheduled() = %d after firing two, want 1", n)
+	}
+	if m.Current() != "idle" {
+		t.Fatalf("Current() = %q after scan and finish fired, want idle", m.Current())
+	}
+
+	m.Stop()
+	if n := m.PendingScheduled(); n != 0 {
+		t.Fatalf("PendingScheduled() = %d after Stop, want 0", n)
+	}
+	clock.Advance(time.Second)
+	if m.Current() != "idle" {
+		t.Fatalf("stopped event fired: Current() = %q", m.Current())
+	}
+}
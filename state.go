@@ -1 +1,144 @@
 package fsm
+
+import "sort"
+
+/**
+AllStates: 返回迁移表中出现过的所有状态(已排序)
+*/
+func (m *Machine) AllStates() []string {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.sortedStates()
+}
+
+/**
+WithStateMeta: 给状态 state 打上标签, 可以多次调用追加标签
+*/
+func WithStateMeta(state string, tags ...string) Option {
+	return func(m *Machine) {
+		if m.stateTags == nil {
+			m.stateTags = make(map[string]map[string]bool)
+		}
+		if m.stateTags[state] == nil {
+			m.stateTags[state] = make(map[string]bool)
+		}
+		for _, tag := range tags {
+			m.stateTags[state][tag] = true
+		}
+	}
+}
+
+/**
+StatesWithTag: 返回带有标签 tag 的所有状态(已排序)
+*/
+func (m *Machine) StatesWithTag(tag string) []string {
+	var states []string
+	for state, tags := range m.stateTags {
+		if tags[tag] {
+			states = append(states, state)
+		}
+	}
+	sort.Strings(states)
+	return states
+}
+
+/**
+CurrentHasTag: 返回当前状态是否带有标签 tag
+*/
+func (m *Machine) CurrentHasTag(tag string) bool {
+	return m.stateTags[m.Current()][tag]
+}
+
+// hasState 返回 state 是否出现在迁移表中
+func (m *Machine) hasState(state string) bool {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	for key, dst := range m.transitions {
+		if key.src == state || dst == state {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+WithFinalStates: 把 states 标记为终止状态
+*/
+func WithFinalStates(states ...string) Option {
+	return func(m *Machine) {
+		if m.finalStates == nil {
+			m.finalStates = make(map[string]bool)
+		}
+		for _, state := range states {
+			m.finalStates[state] = true
+		}
+	}
+}
+
+/**
+IsFinal: 返回当前状态是否为终止状态
+*/
+func (m *Machine) IsFinal() bool {
+	return m.finalStates[m.Current()]
+}
+
+/**
+OnFinal: 注册在迁移进入任意终止状态(见 WithFinalStates)时调用的函数
+在 OnTransition 注册的函数之后, after_event 回调之前执行, 多个函数按注册顺序执行
+*/
+func (m *Machine) OnFinal(fn func(e *Event)) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.onFinal = append(m.onFinal, fn)
+}
+
+/**
+IsStuck: 返回当前状态是否没有任何可执行的事件, 且没有进行中的异步迁移
+与 IsFinal 不同, 不需要事先配置
+*/
+func (m *Machine) IsStuck() bool {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.transition == nil && len(m.eventsFrom(m.current)) == 0
+}
+
+/**
+WithErrorState: 把 state 配置为错误状态, 进入该状态后自动执行补偿事件 compensateEvent
+补偿事件优先于该状态上的其他自动事件; NewMachineChecked 会检查补偿事件能否在 state 下执行
+*/
+func WithErrorState(state, compensateEvent string) Option {
+	return func(m *Machine) {
+		if m.errorStates == nil {
+			m.errorStates = make(map[string]string)
+		}
+		m.errorStates[state] = compensateEvent
+	}
+}
+
+// checkErrorStates 检查每个错误状态的补偿事件都能在该状态下执行
+func (m *Machine) checkErrorStates() error {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	states := make([]string, 0, len(m.errorStates))
+	for state := range m.errorStates {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		event := m.errorStates[state]
+		if _, ok := m.transitions[eKey{event, state}]; !ok {
+			return InvalidEventError{Event: event, State: state, Available: m.eventsFrom(state)}
+		}
+	}
+	return nil
+}
+
+// tagsOf 返回状态 state 的所有标签(已排序)
+func (m *Machine) tagsOf(state string) []string {
+	tags := make([]string, 0, len(m.stateTags[state]))
+	for tag := range m.stateTags[state] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
@@ -0,0 +1,134 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// errorStateEvents 定义了一个可以进入错误状态 err 并通过 compensate 回到 idle 的状态机
+func errorStateEvents() Events {
+	return Events{
+		{Name: "run", Src: []string{"idle"}, Dst: "running"},
+		{Name: "fail", Src: []string{"running"}, Dst: "err"},
+		{Name: "compensate", Src: []string{"err"}, Dst: "idle"},
+	}
+}
+
+func TestErrorStateFiresCompensation(t *testing.T) {
+	var compensated int
+	m, err := NewMachineChecked("idle", errorStateEvents(), Callbacks{
+		"after_compensate": func(e *Event) { compensated++ },
+	}, WithErrorState("err", "compensate"))
+	if err != nil {
+		t.Fatalf("NewMachineChecked = %v", err)
+	}
+
+	m.Event("run")
+	if err := m.Event("fail"); err != nil {
+		t.Fatalf("Event(fail) = %v", err)
+	}
+	if m.Current() != "idle" || compensated != 1 {
+		t.Fatalf("after fail: state %q, compensate ran %d times; want idle, 1", m.Current(), compensated)
+	}
+}
+
+func TestErrorStateAfterAsyncTransition(t *testing.T) {
+	var compensated int
+	m := NewMachine("idle", errorStateEvents(), Callbacks{
+		"leave_running":    func(e *Event) { e.Async() },
+		"after_compensate": func(e *Event) { compensated++ },
+	}, WithErrorState("err", "compensate"))
+
+	m.Event("run")
+	if _, ok := m.Event("fail").(AsyncError); !ok {
+		t.Fatal("Event(fail) should be deferred by e.Async()")
+	}
+	if err := m.Transition(); err != nil {
+		t.Fatalf("Transition() = %v", err)
+	}
+	if m.Current() != "idle" || compensated != 1 {
+		t.Fatalf("after Transition: state %q, compensate ran %d times; want idle, 1", m.Current(), compensated)
+	}
+}
+
+func TestErrorStateInvalidCompensation(t *testing.T) {
+	_, err := NewMachineChecked("idle", errorStateEvents(), nil, WithErrorState("err", "run"))
+	if e, ok := err.(InvalidEventError); !ok || e.Event != "run" || e.State != "err" {
+		t.Fatalf("NewMachineChecked = %v, want InvalidEventError for run from err", err)
+	}
+}
+
+func TestOnFinalFiresForEveryFinalState(t *testing.T) {
+	events := Events{
+		{Name: "finish", Src: []string{"running"}, Dst: "done"},
+		{Name: "abort", Src: []string{"running"}, Dst: "aborted"},
+		{Name: "restart", Src: []string{"done", "aborted"}, Dst: "running"},
+	}
+	var finals []string
+	m := NewMachine("running", events, nil, WithFinalStates("done", "aborted"))
+	m.OnFinal(func(e *Event) { finals = append(finals, e.Event+":"+e.Dst) })
+
+	for _, event := range []string{"finish", "restart", "abort", "restart"} {
+		if err := m.Event(event); err != nil {
+			t.Fatalf("Event(%s) = %v", event, err)
+		}
+	}
+	if len(finals) != 2 || finals[0] != "finish:done" || finals[1] != "abort:aborted" {
+		t.Fatalf("OnFinal got %v, want [finish:done abort:aborted]", finals)
+	}
+}
+
+func TestStateTags(t *testing.T) {
+	m := NewMachine("idle", Events{
+		{Name: "start", Src: []string{"idle"}, Dst: "running"},
+		{Name: "pause", Src: []string{"running"}, Dst: "paused"},
+		{Name: "fail", Src: []string{"running", "paused"}, Dst: "failed"},
+	}, nil,
+		WithStateMeta("running", "billable"),
+		WithStateMeta("paused", "billable"),
+		WithStateMeta("failed", "error", "terminal"))
+
+	if want := []string{"paused", "running"}; !reflect.DeepEqual(m.StatesWithTag("billable"), want) {
+		t.Fatalf("StatesWithTag(billable) = %v, want %v", m.StatesWithTag("billable"), want)
+	}
+	if got := m.StatesWithTag("unknown"); len(got) != 0 {
+		t.Fatalf("StatesWithTag(unknown) = %v, want none", got)
+	}
+
+	steps := []struct {
+		event    string
+		billable bool
+		terminal bool
+	}{
+		{"", false, false},
+		{"start", true, false},
+		{"pause", true, false},
+		{"fail", false, true},
+	}
+	for _, step := range steps {
+		if step.event != "" {
+			if err := m.Event(step.event); err != nil {
+				t.Fatalf("Event(%s) = %v", step.event, err)
+			}
+		}
+		if m.CurrentHasTag("billable") != step.billable || m.CurrentHasTag("terminal") != step.terminal {
+			t.Fatalf("in %q: billable=%v terminal=%v, want %v %v", m.Current(),
+				m.CurrentHasTag("billable"), m.CurrentHasTag("terminal"), step.billable, step.terminal)
+		}
+	}
+}
+
+func TestIsStuck(t *testing.T) {
+	m := NewMachine("idle", deadEndEvents(), nil)
+	if m.IsStuck() {
+		t.Fatalf("IsStuck() = true in idle")
+	}
+	m.Event("start")
+	m.Event("archive")
+	if !m.IsStuck() {
+		t.Fatalf("IsStuck() = false in dead-end state %q", m.Current())
+	}
+	if m.IsFinal() {
+		t.Fatalf("IsFinal() = true for an unconfigured dead end")
+	}
+}
@@ -0,0 +1,60 @@
+package fsm
+
+import "time"
+
+// StateStat 是一个状态的统计信息
+type StateStat struct {
+	// Entries 是通过迁移进入该状态的次数
+	Entries int
+	// Dwell 是停留在该状态的累计时间
+	Dwell time.Duration
+}
+
+/**
+Stats: 返回各状态的统计信息, 当前状态的停留时间计算到调用时为止
+*/
+func (m *Machine) Stats() map[string]StateStat {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.statsSnapshot(m.clock.Now())
+}
+
+/**
+StatsAndReset: 返回各状态的统计信息并清空, 当前状态的停留时间从调用时重新开始计算
+*/
+func (m *Machine) StatsAndReset() map[string]StateStat {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	now := m.clock.Now()
+	stats := m.statsSnapshot(now)
+	m.stats = nil
+	m.enteredAt = now
+	return stats
+}
+
+// statsSnapshot 复制统计信息并加上当前状态到 now 为止的停留时间, 调用方需持有 stateMu
+func (m *Machine) statsSnapshot(now time.Time) map[string]StateStat {
+	stats := make(map[string]StateStat, len(m.stats)+1)
+	for state, stat := range m.stats {
+		stats[state] = stat
+	}
+	stat := stats[m.current]
+	stat.Dwell += now.Sub(m.enteredAt)
+	stats[m.current] = stat
+	return stats
+}
+
+// recordEntry 记录从当前状态离开并进入 state, 调用方需持有 stateMu 的写锁
+func (m *Machine) recordEntry(state string) {
+	now := m.clock.Now()
+	if m.stats == nil {
+		m.stats = make(map[string]StateStat)
+	}
+	from := m.stats[m.current]
+	from.Dwell += now.Sub(m.enteredAt)
+	m.stats[m.current] = from
+	to := m.stats[state]
+	to.Entries++
+	m.stats[state] = to
+	m.enteredAt = now
+}
@@ -0,0 +1,42 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsAndReset(t *testing.T) {
+	clock := newFakeClock()
+	m := NewMachine("idle", exampleEvents(), nil, WithClock(clock))
+
+	clock.Advance(time.Second)
+	m.Event("scan")
+	clock.Advance(2 * time.Second)
+	m.Event("finish")
+	clock.Advance(3 * time.Second)
+
+	want := map[string]StateStat{
+		"idle":     {Entries: 1, Dwell: 4 * time.Second},
+		"scanning": {Entries: 1, Dwell: 2 * time.Second},
+	}
+	if got := m.StatsAndReset(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("first StatsAndReset() = %v, want %v", got, want)
+	}
+
+	// 第二次只包含重置后的活动, 当前状态的停留时间从重置时开始计算
+	clock.Advance(5 * time.Second)
+	m.Event("scan")
+	clock.Advance(time.Second)
+
+	want = map[string]StateStat{
+		"idle":     {Dwell: 5 * time.Second},
+		"scanning": {Entries: 1, Dwell: time.Second},
+	}
+	if got := m.StatsAndReset(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("second StatsAndReset() = %v, want %v", got, want)
+	}
+	if got := m.Stats(); !reflect.DeepEqual(got, map[string]StateStat{"scanning": {}}) {
+		t.Fatalf("Stats() after reset = %v, want only an empty scanning entry", got)
+	}
+}
@@ -1,5 +1,7 @@
 package fsm
 
+import "time"
+
 type transitioner interface {
 	transition(machine *Machine) error
 }
@@ -7,10 +9,60 @@ type transitioner interface {
 type transitionerStruct struct{}
 
 func (t transitionerStruct) transition(m *Machine) error {
-	if m.transition == nil {
+	// 先清除再执行, 提交后自动执行的事件(Transient)不会因为迁移尚未完成而被拒绝
+	m.stateMu.Lock()
+	commit := m.transition
+	m.transition = nil
+	m.stateMu.Unlock()
+	if commit == nil {
 		return NotInTransitionError{}
 	}
-	m.transition()
-	m.transition = nil
+	commit()
 	return nil
 }
+
+// Transition 描述状态迁移表中的一条边
+type Transition struct {
+	Event string `json:"event"`
+	Src   string `json:"src"`
+	Dst   string `json:"dst"`
+}
+
+/**
+WithAsyncTimeout: leave 回调调用 e.Async() 推迟迁移后, 如果 d 之内没有调用 Transition,
+则自动取消该迁移并执行 on_async_timeout 回调
+*/
+func WithAsyncTimeout(d time.Duration) Option {
+	return func(m *Machine) {
+		m.asyncTimeout = d
+	}
+}
+
+// startAsyncTimeout 为 e 推迟的迁移启动超时定时器, 调用方需持有 eventMu
+func (m *Machine) startAsyncTimeout(e *Event) {
+	if m.asyncTimeout <= 0 {
+		return
+	}
+	m.asyncSeq++
+	seq := m.asyncSeq
+	m.clock.AfterFunc(m.asyncTimeout, func() {
+		gid, err := m.lockEventsOwned("on_async_timeout")
+		if err != nil {
+			return
+		}
+		defer m.unlockEvents(gid)
+
+		m.stateMu.Lock()
+		expired := m.transition != nil && m.asyncSeq == seq
+		if expired {
+			m.transition = nil
+		}
+		m.stateMu.Unlock()
+
+		if expired {
+			if fn, ok := m.callbacks[cKey{"", callbackAsyncTimeout}]; ok {
+				fn(e)
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package fsm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsyncTimeoutCancelsPendingTransition(t *testing.T) {
+	clock := newFakeClock()
+	var timedOut *Event
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_idle":       func(e *Event) { e.Async() },
+		"on_async_timeout": func(e *Event) { timedOut = e },
+	}, WithClock(clock), WithAsyncTimeout(time.Second))
+
+	if _, ok := m.Event("scan").(AsyncError); !ok {
+		t.Fatalf("Event(scan) should start an async transition")
+	}
+	clock.Advance(999 * time.Millisecond)
+	if !m.IsTransitioning() || timedOut != nil {
+		t.Fatalf("transition canceled before the timeout")
+	}
+
+	clock.Advance(time.Millisecond)
+	if m.IsTransitioning() || m.Current() != "idle" {
+		t.Fatalf("after timeout: transitioning %v in %q, want false in idle", m.IsTransitioning(), m.Current())
+	}
+	if timedOut == nil || timedOut.Event != "scan" || timedOut.Dst != "scanning" {
+		t.Fatalf("on_async_timeout got %+v, want the scan event", timedOut)
+	}
+	if _, ok := m.Transition().(NotInTransitionError); !ok {
+		t.Fatalf("Transition() after timeout should return NotInTransitionError")
+	}
+}
+
+func TestAsyncTimeoutIgnoresCompletedTransition(t *testing.T) {
+	clock := newFakeClock()
+	var timeouts int
+	m := NewMachine("idle", exampleEvents(), Callbacks{
+		"leave_idle":       func(e *Event) { e.Async() },
+		"on_async_timeout": func(e *Event) { timeouts++ },
+	}, WithClock(clock), WithAsyncTimeout(time.Second))
+
+	m.Event("scan")
+	if err := m.Transition(); err != nil {
+		t.Fatalf("Transition() = %v", err)
+	}
+	clock.Advance(2 * time.Second)
+	if m.Current() != "scanning" || timeouts != 0 {
+		t.Fatalf("state %q, %d timeouts; want scanning, 0", m.Current(), timeouts)
+	}
+}
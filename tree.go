@@ -0,0 +1,49 @@
+package fsm
+
+/**
+SetSubMachine: 把 sub 设为状态 state 的子状态机, sub 为 nil 时移除
+子状态机只用于组合和查询, 事件不会自动转发给子状态机
+*/
+func (m *Machine) SetSubMachine(state string, sub *Machine) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if sub == nil {
+		delete(m.subMachines, state)
+		return
+	}
+	if m.subMachines == nil {
+		m.subMachines = make(map[string]*Machine)
+	}
+	m.subMachines[state] = sub
+}
+
+/**
+SubMachine: 返回状态 state 的子状态机
+*/
+func (m *Machine) SubMachine(state string) (*Machine, bool) {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	sub, ok := m.subMachines[state]
+	return sub, ok
+}
+
+/**
+WalkTree: 从根状态机开始, 递归访问当前状态的子状态机
+path 为从根到该状态机的各级当前状态, 例如 ["processing", "validating"]
+*/
+func (m *Machine) WalkTree(fn func(path []string, m *Machine)) {
+	m.walkTree(nil, fn)
+}
+
+func (m *Machine) walkTree(parent []string, fn func(path []string, m *Machine)) {
+	m.stateMu.RLock()
+	current := m.current
+	sub := m.subMachines[current]
+	m.stateMu.RUnlock()
+
+	path := append(append([]string(nil), parent...), current)
+	fn(path, m)
+	if sub != nil {
+		sub.walkTree(path, fn)
+	}
+}
@@ -0,0 +1,45 @@
+package fsm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWalkTree(t *testing.T) {
+	root := NewMachine("idle", Events{
+		{Name: "process", Src: []string{"idle"}, Dst: "processing"},
+	}, nil)
+	sub := NewMachine("validating", Events{
+		{Name: "validated", Src: []string{"validating"}, Dst: "saving"},
+	}, nil)
+	root.SetSubMachine("processing", sub)
+
+	walk := func() (paths []string, machines []*Machine) {
+		root.WalkTree(func(path []string, m *Machine) {
+			paths = append(paths, strings.Join(path, "/"))
+			machines = append(machines, m)
+		})
+		return paths, machines
+	}
+
+	// idle 没有子状态机
+	if paths, _ := walk(); !reflect.DeepEqual(paths, []string{"idle"}) {
+		t.Fatalf("paths in idle = %v, want [idle]", paths)
+	}
+
+	root.Event("process")
+	sub.Event("validated")
+	paths, machines := walk()
+	if want := []string{"processing", "processing/saving"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("paths = %v, want %v", paths, want)
+	}
+	if len(machines) != 2 || machines[0] != root || machines[1] != sub {
+		t.Fatalf("visited machines %v, want root then sub", machines)
+	}
+
+	root.SetSubMachine("processing", nil)
+	if _, ok := root.SubMachine("processing"); ok {
+		t.Fatalf("SubMachine(processing) still set after removal")
+	}
+}
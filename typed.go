@@ -0,0 +1,90 @@
+//go:build go1.21
+
+package fsm
+
+import "fmt"
+
+// TypedEventDesc 与 EventDesc 相同, 但状态和事件使用调用方自己的类型
+type TypedEventDesc[S, E any] struct {
+	Name E
+	Src  []S
+	Dst  S
+}
+
+// TypedMachine 是 Machine 的泛型包装, 内部通过 key 函数把状态和事件映射为字符串
+// go.mod 声明的是 go 1.13, 文件级的构建约束从 Go 1.21 起才会提升语言版本, 因此本文件要求 go1.21
+type TypedMachine[S, E any] struct {
+	m        *Machine
+	stateKey func(S) string
+	eventKey func(E) string
+	states   map[string]S
+}
+
+/**
+NewTypedMachine: 创建状态和事件为任意类型的状态机
+keyFunc 和 eventKeyFunc 把状态和事件映射为内部使用的字符串, 不同的值必须映射为不同的字符串;
+为 nil 时使用 fmt.Sprint, 对于包含指针或无序字段的结构体可能不可靠, 这时应提供自定义函数.
+callbacks 的键使用映射后的字符串
+*/
+func NewTypedMachine[S, E any](initial S, events []TypedEventDesc[S, E], callbacks Callbacks, keyFunc func(S) string, eventKeyFunc func(E) string, opts ...Option) *TypedMachine[S, E] {
+	if keyFunc == nil {
+		keyFunc = func(s S) string { return fmt.Sprint(s) }
+	}
+	if eventKeyFunc == nil {
+		eventKeyFunc = func(e E) string { return fmt.Sprint(e) }
+	}
+	t := &TypedMachine[S, E]{
+		stateKey: keyFunc,
+		eventKey: eventKeyFunc,
+		states:   make(map[string]S),
+	}
+	t.states[keyFunc(initial)] = initial
+	descs := make([]EventDesc, 0, len(events))
+	for _, e := range events {
+		desc := EventDesc{Name: eventKeyFunc(e.Name), Dst: keyFunc(e.Dst)}
+		t.states[desc.Dst] = e.Dst
+		for _, src := range e.Src {
+			key := keyFunc(src)
+			t.states[key] = src
+			desc.Src = append(desc.Src, key)
+		}
+		descs = append(descs, desc)
+	}
+	t.m = NewMachine(keyFunc(initial), descs, callbacks, opts...)
+	return t
+}
+
+/**
+Machine: 返回内部的 Machine, 用于注册回调或调用 TypedMachine 没有包装的方法
+*/
+func (t *TypedMachine[S, E]) Machine() *Machine {
+	return t.m
+}
+
+/**
+Current: 返回当前状态, 当前状态不在定义中(例如通过 Machine().SetState 设置)时返回零值
+*/
+func (t *TypedMachine[S, E]) Current() S {
+	return t.states[t.m.Current()]
+}
+
+/**
+Is: 判断当前状态是否为 state
+*/
+func (t *TypedMachine[S, E]) Is(state S) bool {
+	return t.m.Is(t.stateKey(state))
+}
+
+/**
+Can: 判断在当前状态下能否执行事件 event
+*/
+func (t *TypedMachine[S, E]) Can(event E) bool {
+	return t.m.Can(t.eventKey(event))
+}
+
+/**
+Event: 执行事件 event, 与 Machine.Event 相同
+*/
+func (t *TypedMachine[S, E]) Event(event E, args ...interface{}) error {
+	return t.m.Event(t.eventKey(event), args...)
+}
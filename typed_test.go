@@ -0,0 +1,70 @@
+//go:build go1.21
+
+package fsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+// phase 是结构体类型的状态, 通过 phaseKey 映射为回调中使用的 "stage/step" 形式
+type phase struct {
+	Stage string
+	Step  int
+}
+
+func phaseKey(p phase) string {
+	return fmt.Sprintf("%s/%d", p.Stage, p.Step)
+}
+
+func TestTypedMachineCustomKey(t *testing.T) {
+	var (
+		start   = phase{"build", 1}
+		compile = phase{"build", 2}
+		deploy  = phase{"deploy", 1}
+	)
+	events := []TypedEventDesc[phase, string]{
+		{Name: "next", Src: []phase{start}, Dst: compile},
+		{Name: "ship", Src: []phase{compile}, Dst: deploy},
+	}
+	var entered []string
+	m := NewTypedMachine(start, events, Callbacks{
+		"enter_state": func(e *Event) { entered = append(entered, e.Dst) },
+	}, phaseKey, nil)
+
+	if m.Can("ship") {
+		t.Fatalf("Can(ship) = true in %v", m.Current())
+	}
+	for _, event := range []string{"next", "ship"} {
+		if err := m.Event(event); err != nil {
+			t.Fatalf("Event(%s) = %v", event, err)
+		}
+	}
+	if m.Current() != deploy || !m.Is(deploy) {
+		t.Fatalf("Current() = %v, want %v", m.Current(), deploy)
+	}
+	if len(entered) != 2 || entered[0] != "build/2" || entered[1] != "deploy/1" {
+		t.Fatalf("enter_state saw %v, want [build/2 deploy/1]", entered)
+	}
+}
+
+func TestTypedMachineDefaultKey(t *testing.T) {
+	type light int
+	const (
+		red light = iota
+		green
+	)
+	m := NewTypedMachine(red, []TypedEventDesc[light, string]{
+		{Name: "go", Src: []light{red}, Dst: green},
+	}, nil, nil, nil)
+
+	if err := m.Event("go"); err != nil {
+		t.Fatalf("Event(go) = %v", err)
+	}
+	if m.Current() != green {
+		t.Fatalf("Current() = %v, want %v", m.Current(), green)
+	}
+	if _, ok := m.Event("go").(InvalidEventError); !ok {
+		t.Fatalf("second Event(go) should return InvalidEventError")
+	}
+}
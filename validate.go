@@ -0,0 +1,28 @@
+package fsm
+
+/**
+Validate: 检查定义中可能的错误, 没有问题时返回 nil
+没有任何出边且没有标记为终止状态的状态会报告 DanglingStateError,
+从初始状态无法到达的状态会报告 UnreachableStateError
+*/
+func (m *Machine) Validate() []error {
+	reachable := m.ReachableStates()
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+
+	outgoing := make(map[string]bool)
+	for key := range m.transitions {
+		outgoing[key.src] = true
+	}
+
+	var errs []error
+	for _, state := range m.sortedStates() {
+		if !outgoing[state] && !m.finalStates[state] {
+			errs = append(errs, DanglingStateError{State: state})
+		}
+		if !reachable[state] {
+			errs = append(errs, UnreachableStateError{State: state})
+		}
+	}
+	return errs
+}
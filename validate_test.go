@@ -0,0 +1,32 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+// deadEndEvents 中 archived 只作为目标状态出现, 没有任何出边
+func deadEndEvents() Events {
+	return Events{
+		{Name: "start", Src: []string{"idle"}, Dst: "running"},
+		{Name: "stop", Src: []string{"running"}, Dst: "idle"},
+		{Name: "archive", Src: []string{"running"}, Dst: "archived"},
+	}
+}
+
+func TestValidateReportsDanglingState(t *testing.T) {
+	m := NewMachine("idle", deadEndEvents(), nil)
+
+	want := []error{DanglingStateError{State: "archived"}}
+	if errs := m.Validate(); !reflect.DeepEqual(errs, want) {
+		t.Fatalf("Validate() = %v, want %v", errs, want)
+	}
+}
+
+func TestValidateAcceptsFinalState(t *testing.T) {
+	m := NewMachine("idle", deadEndEvents(), nil, WithFinalStates("archived"))
+
+	if errs := m.Validate(); errs != nil {
+		t.Fatalf("Validate() = %v, want nil", errs)
+	}
+}
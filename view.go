@@ -0,0 +1,47 @@
+package fsm
+
+// MachineView 是 Machine 的只读视图, 只能查询状态, 不能触发事件或修改状态
+type MachineView interface {
+	Current() string
+	Is(state string) bool
+	Can(event string) bool
+	AvailableTransitions() []string
+	AllStates() []string
+	AllEvents() []string
+}
+
+// machineView 包装 Machine, 防止调用方通过类型断言拿回 *Machine
+type machineView struct {
+	m *Machine
+}
+
+/**
+View: 返回与 Machine 共享状态的只读视图
+*/
+func (m *Machine) View() MachineView {
+	return machineView{m}
+}
+
+func (v machineView) Current() string {
+	return v.m.Current()
+}
+
+func (v machineView) Is(state string) bool {
+	return v.m.Is(state)
+}
+
+func (v machineView) Can(event string) bool {
+	return v.m.Can(event)
+}
+
+func (v machineView) AvailableTransitions() []string {
+	return v.m.AvailableTransitions()
+}
+
+func (v machineView) AllStates() []string {
+	return v.m.AllStates()
+}
+
+func (v machineView) AllEvents() []string {
+	return v.m.AllEvents()
+}
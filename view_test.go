@@ -0,0 +1,41 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestViewReflectsLiveState(t *testing.T) {
+	m := NewMachine("idle", exampleEvents(), nil)
+	v := m.View()
+
+	if !v.Is("idle") || !v.Can("scan") {
+		t.Fatalf("view in %q: Is(idle)=%v Can(scan)=%v", v.Current(), v.Is("idle"), v.Can("scan"))
+	}
+	m.Event("scan")
+	if v.Current() != "scanning" {
+		t.Fatalf("view Current() = %q after scan, want scanning", v.Current())
+	}
+	if want := []string{"finish", "situation", "working"}; !reflect.DeepEqual(v.AvailableTransitions(), want) {
+		t.Fatalf("AvailableTransitions() = %v, want %v", v.AvailableTransitions(), want)
+	}
+	if want := []string{"idle", "scanning"}; !reflect.DeepEqual(v.AllStates(), want) {
+		t.Fatalf("AllStates() = %v, want %v", v.AllStates(), want)
+	}
+	if want := []string{"finish", "scan", "situation", "working"}; !reflect.DeepEqual(v.AllEvents(), want) {
+		t.Fatalf("AllEvents() = %v, want %v", v.AllEvents(), want)
+	}
+}
+
+func TestViewHasNoMutatingMethods(t *testing.T) {
+	v := NewMachine("idle", exampleEvents(), nil).View()
+
+	if _, ok := v.(*Machine); ok {
+		t.Fatalf("view can be asserted back to *Machine")
+	}
+	for _, name := range []string{"Event", "SetState", "Transition"} {
+		if _, ok := reflect.TypeOf(v).MethodByName(name); ok {
+			t.Fatalf("view exposes mutating method %s", name)
+		}
+	}
+}